@@ -0,0 +1,158 @@
+package vsohash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash/crc64"
+	"sync"
+)
+
+// A BlockCache remembers the hashes of blocks that have been seen before, so they don't have to be
+// hashed again. This is useful when hashing lots of large inputs that share a lot of identical
+// blocks (for example container image layers).
+//
+// Blocks are keyed by a fingerprint, which is the CRC-64 (using the ECMA polynomial) of the block's contents.
+// That is cheap to compute but is not collision-resistant, so the block itself is also passed in;
+// implementations must check a candidate entry's contents match before returning it from Get, otherwise
+// colliding blocks will produce incorrect hashes.
+// Neither method may retain the block slice after it returns; it must be copied if needed.
+//
+// Implementations must be safe for concurrent use if the cache is shared between several hashes
+// that are used concurrently.
+type BlockCache interface {
+	// Get returns the hash of the given block, if it's been seen before.
+	Get(fingerprint uint64, block []byte) ([sha256.Size]byte, bool)
+	// Put records the hash of the given block.
+	Put(fingerprint uint64, block []byte, hash [sha256.Size]byte)
+}
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// A MemoryBlockCache is a BlockCache that keeps a copy of up to a fixed number of blocks in memory, evicting the
+// oldest once it's full. Each is compared in full to a block being looked up if their fingerprints match, so
+// a collision can't change the result; the cost is 2MB of memory per block, so it's only worth it for inputs
+// that repeat the same blocks a lot (e.g. disk images). It's safe for concurrent use.
+type MemoryBlockCache struct {
+	mutex   sync.Mutex
+	entries map[uint64][]memoryCacheEntry
+	// The fingerprints of the entries in the order they were added (this wraps round once it's full).
+	order []uint64
+	next  int
+}
+
+type memoryCacheEntry struct {
+	block []byte
+	hash  [sha256.Size]byte
+}
+
+// NewMemoryBlockCache returns a new MemoryBlockCache that holds up to the given number of blocks.
+func NewMemoryBlockCache(maxBlocks int) *MemoryBlockCache {
+	if maxBlocks <= 0 {
+		panic("Cache size must be strictly positive")
+	}
+	return &MemoryBlockCache{
+		entries: map[uint64][]memoryCacheEntry{},
+		order:   make([]uint64, 0, maxBlocks),
+	}
+}
+
+// Get implements BlockCache.
+func (c *MemoryBlockCache) Get(fingerprint uint64, block []byte) ([sha256.Size]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, entry := range c.entries[fingerprint] {
+		if bytes.Equal(entry.block, block) {
+			return entry.hash, true
+		}
+	}
+	return [sha256.Size]byte{}, false
+}
+
+// Put implements BlockCache.
+func (c *MemoryBlockCache) Put(fingerprint uint64, block []byte, hash [sha256.Size]byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, entry := range c.entries[fingerprint] {
+		if bytes.Equal(entry.block, block) {
+			return // Another hash got here first
+		}
+	}
+	var buf []byte
+	if len(c.order) < cap(c.order) {
+		c.order = append(c.order, fingerprint)
+	} else {
+		// Evict the oldest entry. Entries with each fingerprint are in the order they were added too,
+		// so it's the first of those; its buffer can be reused for the new one.
+		oldest := c.order[c.next]
+		buf = c.entries[oldest][0].block[:0]
+		if entries := c.entries[oldest][1:]; len(entries) > 0 {
+			c.entries[oldest] = entries
+		} else {
+			delete(c.entries, oldest)
+		}
+		c.order[c.next] = fingerprint
+		c.next = (c.next + 1) % len(c.order)
+	}
+	c.entries[fingerprint] = append(c.entries[fingerprint], memoryCacheEntry{
+		block: append(buf, block...),
+		hash:  hash,
+	})
+}
+
+// Len returns the number of blocks currently in the cache.
+func (c *MemoryBlockCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.order)
+}
+
+// writeCached is the implementation of Write when we have a block cache.
+// We can't dispatch any pages until we know whether the block they're in has been seen before,
+// so everything is buffered up and handled a block at a time.
+func (v *vsoHash) writeCached(in []byte) (int, error) {
+	n := len(in)
+	for len(in) > 0 {
+		if err := v.interrupted(len(in)); err != nil {
+			return n - len(in), err
+		}
+		m := BlockSize - len(v.block)
+		if m > len(in) {
+			m = len(in)
+		}
+		v.block = append(v.block, in[:m]...)
+		in = in[m:]
+		if len(v.block) == BlockSize {
+			if err := v.finishCachedBlock(); err != nil {
+				v.written -= int64(len(in))
+				return n - len(in), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// finishCachedBlock finishes the current block, either by retrieving it from the cache or
+// by hashing it (in which case it's added to the cache afterwards).
+// If the block couldn't be hashed (because a page panicked or the context was cancelled) it returns
+// the error; nothing is added to the cache in that case, since it's shared with other hashes.
+func (v *vsoHash) finishCachedBlock() error {
+	fingerprint := crc64.Checksum(v.block, crcTable)
+	h, ok := v.opts.cache.Get(fingerprint, v.block)
+	if !ok {
+		for i := 0; i < len(v.block); i += PageSize {
+			end := i + PageSize
+			if end > len(v.block) {
+				end = len(v.block)
+			}
+			v.dispatchPage(hashTask{Input: v.block[i:end]})
+		}
+		// This waits for all the pages to be done, so after this it's safe to reuse v.block.
+		if _, ok := v.blockHash(h[:0]); !ok {
+			return v.writable()
+		}
+		v.opts.cache.Put(fingerprint, v.block, h)
+	}
+	v.updateBlobID(h[:])
+	v.block = v.block[:0]
+	return nil
+}
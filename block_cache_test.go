@@ -0,0 +1,217 @@
+package vsohash
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash/crc64"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mapCache is a simple BlockCache for testing that also counts how often it has been hit.
+type mapCache struct {
+	mutex   sync.Mutex
+	entries map[uint64][]cacheEntry
+	hits    int
+}
+
+type cacheEntry struct {
+	block []byte
+	hash  [sha256.Size]byte
+}
+
+func newMapCache() *mapCache {
+	return &mapCache{entries: map[uint64][]cacheEntry{}}
+}
+
+func (c *mapCache) Get(fingerprint uint64, block []byte) ([sha256.Size]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, entry := range c.entries[fingerprint] {
+		if bytes.Equal(entry.block, block) {
+			c.hits++
+			return entry.hash, true
+		}
+	}
+	return [sha256.Size]byte{}, false
+}
+
+func (c *mapCache) Put(fingerprint uint64, block []byte, hash [sha256.Size]byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[fingerprint] = append(c.entries[fingerprint], cacheEntry{
+		block: append([]byte(nil), block...),
+		hash:  hash,
+	})
+}
+
+// repeatedBlocks returns an input made up of n copies of the same block, plus a few trailing bytes.
+func repeatedBlocks(n, tail int) []byte {
+	in := make([]byte, 0, n*BlockSize+tail)
+	for i := 0; i < n*BlockSize+tail; i++ {
+		in = append(in, byte((i%BlockSize)&0xff))
+	}
+	return in
+}
+
+func TestBlockCacheMatchesUncached(t *testing.T) {
+	for _, lim := range []int{0, 1, PageSize, BlockSize - 1, BlockSize, BlockSize + 1, 3*BlockSize + PageSize + 7} {
+		t.Run(fmt.Sprintf("Size%d", lim), func(t *testing.T) {
+			in := sequentialInput(lim)
+			h := New(WithBlockCache(newMapCache()))
+			h.Write(in)
+			assert.Equal(t, Sum(in), sumArray(h))
+		})
+	}
+}
+
+func TestBlockCachePaged(t *testing.T) {
+	in := sequentialInput(3*BlockSize + PageSize + 7)
+	uncached := NewPaged(PageSize, BlockSize, 2)
+	uncached.Write(in)
+	h := NewPaged(PageSize, BlockSize, 2, WithBlockCache(newMapCache()))
+	h.Write(in)
+	h.Write(in) // Second time round, it's all from the cache.
+	uncached.Write(in)
+	assert.Equal(t, uncached.Sum(nil), h.Sum(nil))
+	// Any other structure would need its own kind of block hash, so isn't permitted.
+	assert.Panics(t, func() { NewPaged(1024, 4096, 2, WithBlockCache(newMapCache())) })
+	assert.Panics(t, func() { NewPaged(PageSize, 2*BlockSize, 2, WithBlockCache(newMapCache())) })
+}
+
+func TestBlockCacheHitsRepeatedBlocks(t *testing.T) {
+	cache := newMapCache()
+	in := repeatedBlocks(4, 12345)
+	h := New(WithBlockCache(cache))
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+	assert.Equal(t, 3, cache.hits)
+
+	// A second hash sharing the cache should get hits for all its full blocks.
+	in = repeatedBlocks(2, 0)
+	h = New(WithBlockCache(cache))
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+	assert.Equal(t, 5, cache.hits)
+}
+
+func TestBlockCacheUnalignedWrites(t *testing.T) {
+	in := repeatedBlocks(3, PageSize+1)
+	h := New(WithBlockCache(newMapCache()))
+	for len(in) > 0 {
+		n := 100003
+		if n > len(in) {
+			n = len(in)
+		}
+		h.Write(in[:n])
+		in = in[n:]
+	}
+	assert.Equal(t, Sum(repeatedBlocks(3, PageSize+1)), sumArray(h))
+}
+
+func TestBlockCacheCollision(t *testing.T) {
+	// Plant an entry for a different block under the same fingerprint; it must not be used.
+	cache := newMapCache()
+	in := sequentialInput(BlockSize)
+	cache.Put(crc64.Checksum(in, crcTable), make([]byte, BlockSize), sha256.Sum256(nil))
+	h := New(WithBlockCache(cache))
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+	assert.Equal(t, 0, cache.hits)
+}
+
+// A cancellingCache is a mapCache that cancels a context when it's asked for the nth block.
+type cancellingCache struct {
+	*mapCache
+	cancel func()
+	n      int
+}
+
+func (c *cancellingCache) Get(fingerprint uint64, block []byte) ([sha256.Size]byte, bool) {
+	if c.n--; c.n == 0 {
+		c.cancel()
+	}
+	return c.mapCache.Get(fingerprint, block)
+}
+
+func TestBlockCacheCancelled(t *testing.T) {
+	// Make each block distinct so none of them come from the cache.
+	in := sequentialInput(8 * BlockSize)
+	for i := 0; i < len(in); i += BlockSize {
+		in[i] = byte(i / BlockSize)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := &cancellingCache{mapCache: newMapCache(), cancel: cancel, n: 3}
+	h := NewWithContext(ctx, 4, WithBlockCache(cache)).(Hasher)
+	defer h.Close()
+	n, err := h.Write(in)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 3*BlockSize, n) // The third block was written, but not hashed.
+	assert.EqualValues(t, n, h.BytesWritten())
+	// Only the blocks that were hashed before it was cancelled should have made it into the cache.
+	assert.Equal(t, 2, len(cache.entries))
+	for _, entries := range cache.entries {
+		for _, entry := range entries {
+			assert.Equal(t, BlockHash(entry.block), entry.hash)
+		}
+	}
+	// So another hash sharing the cache still gets the right answer.
+	h2 := New(WithBlockCache(cache.mapCache))
+	h2.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h2))
+}
+
+func sumArray(h interface{ Sum([]byte) []byte }) [Size]byte {
+	var ret [Size]byte
+	copy(ret[:], h.Sum(nil))
+	return ret
+}
+
+func TestMemoryBlockCache(t *testing.T) {
+	cache := NewMemoryBlockCache(2)
+	in := repeatedBlocks(4, 12345)
+	h := New(WithBlockCache(cache))
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+	// Only the one distinct full block gets stored, plus the partial one at the end.
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestMemoryBlockCacheCollision(t *testing.T) {
+	cache := NewMemoryBlockCache(2)
+	in := sequentialInput(BlockSize)
+	fingerprint := crc64.Checksum(in, crcTable)
+	cache.Put(fingerprint, make([]byte, BlockSize), sha256.Sum256(nil))
+	_, ok := cache.Get(fingerprint, in)
+	assert.False(t, ok)
+	h := New(WithBlockCache(cache))
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestMemoryBlockCacheEviction(t *testing.T) {
+	cache := NewMemoryBlockCache(2)
+	blocks := make([][]byte, 3)
+	for i := range blocks {
+		blocks[i] = bytes.Repeat([]byte{byte(i)}, 16)
+		cache.Put(uint64(i%2), blocks[i], sha256.Sum256(blocks[i]))
+	}
+	assert.Equal(t, 2, cache.Len())
+	_, ok := cache.Get(0, blocks[0])
+	assert.False(t, ok, "the oldest block should have been evicted")
+	for _, i := range []int{1, 2} {
+		hash, ok := cache.Get(uint64(i%2), blocks[i])
+		assert.True(t, ok)
+		assert.Equal(t, sha256.Sum256(blocks[i]), hash)
+	}
+	// Putting the same block again doesn't evict anything.
+	cache.Put(1, blocks[1], sha256.Sum256(blocks[1]))
+	_, ok = cache.Get(0, blocks[2])
+	assert.True(t, ok)
+}
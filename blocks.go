@@ -0,0 +1,105 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+)
+
+// A BlockInfo describes a single block of the input.
+type BlockInfo struct {
+	// The offset of the start of the block within the input
+	Offset int64
+	// The length of the block. This is BlockSize for all but the last block, which may be shorter.
+	Length int64
+	// The hash of the block
+	Hash [sha256.Size]byte
+}
+
+// PageHash returns the hash of a single page, which is just its SHA256. All pages except the last one
+// of a block must be exactly PageSize long; the last one can be shorter, in which case it's hashed as it
+// is (there's no padding).
+// It panics if the page is longer than PageSize.
+func PageHash(page []byte) [sha256.Size]byte {
+	if len(page) > PageSize {
+		panic("Page is longer than PageSize")
+	}
+	return sum256(page)
+}
+
+// BlockHash returns the hash of a single block, as used to build up the VSO-Hash identifier; this is
+// the SHA256 of the concatenated hashes of each of its pages (see PageHash). All blocks except the last
+// one of an input must be exactly BlockSize long; the last one can be shorter (including empty, if the
+// entire input is empty).
+// This allows the blocks of an input to be hashed independently (e.g. on different machines), and
+// combined afterwards.
+// It panics if the block is longer than BlockSize.
+func BlockHash(block []byte) [sha256.Size]byte {
+	if len(block) > BlockSize {
+		panic("Block is longer than BlockSize")
+	}
+	var pages [PagesPerBlock * sha256.Size]byte
+	n := 0
+	for i := 0; i < len(block); i += PageSize {
+		end := i + PageSize
+		if end > len(block) {
+			end = len(block)
+		}
+		h := PageHash(block[i:end])
+		n += copy(pages[n:], h[:])
+	}
+	return sum256(pages[:n])
+}
+
+// BlockHashes returns the hashes of each block hashed so far, in order. These can be used to build a
+// block-level dedupe index, for example.
+// Any incomplete final block is included, so once everything has been written it describes the whole input.
+// The returned slice is a copy and can be retained after the hash is reset.
+// Block hashes are only recorded when the inner hash is SHA256; for other paged hashes (see NewPagedHash)
+// this always returns nothing. It also returns nothing if hashing any page failed (see PanicError),
+// since the blocks after the failed one can't be trusted; SumErr returns the error.
+func (v *vsoHash) BlockHashes() [][sha256.Size]byte {
+	v.resolveBlocks()
+	if v.err != nil {
+		return nil
+	}
+	hashes := append([][sha256.Size]byte(nil), v.blockHashes...)
+	if v.inner.Size() == sha256.Size {
+		var h [sha256.Size]byte
+		if _, ok := v.pendingBlockHash(h[:0]); ok {
+			hashes = append(hashes, h)
+		}
+	}
+	return hashes
+}
+
+// blockHashesErr is like BlockHashes, but returns an error (as for SumErr) if they can't all be calculated,
+// i.e. if hashing any page panicked or the hash's context was cancelled (in which case some may have been dropped).
+func (v *vsoHash) blockHashesErr() ([][sha256.Size]byte, error) {
+	hashes := v.BlockHashes()
+	if v.err != nil {
+		return nil, v.err
+	} else if err := v.opts.ctxErr(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// Blocks is like BlockHashes but also reports the offset and length of each block, which saves the caller
+// from calculating them (and getting the final short block wrong).
+// Like BlockHashes, it returns nothing if hashing any page failed.
+func (v *vsoHash) Blocks() []BlockInfo {
+	blockSize := int64(v.pageSize * v.pagesPerBlock)
+	hashes := v.BlockHashes()
+	if hashes == nil {
+		return nil
+	}
+	blocks := make([]BlockInfo, len(hashes))
+	for i, h := range hashes {
+		offset := int64(i) * blockSize
+		length := v.written - offset
+		if length > blockSize {
+			length = blockSize
+		}
+		blocks[i] = BlockInfo{Offset: offset, Length: length, Hash: h}
+	}
+	return blocks
+}
@@ -0,0 +1,140 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlocks(t *testing.T) {
+	for _, lim := range []int{0, 1, BlockSize - 1, BlockSize, BlockSize + 1, 3*BlockSize + PageSize} {
+		for _, cached := range []bool{false, true} {
+			t.Run(fmt.Sprintf("Size%dCached%v", lim, cached), func(t *testing.T) {
+				in := sequentialInput(lim)
+				var opts []Option
+				if cached {
+					opts = append(opts, WithBlockCache(newMapCache()))
+				}
+				h := New(opts...).(Hasher)
+				h.Write(in)
+				h.Sum(nil)
+				var expected []BlockInfo
+				var hashes [][sha256.Size]byte
+				for i := 0; i == 0 || i < lim; i += BlockSize {
+					end := i + BlockSize
+					if end > lim {
+						end = lim
+					}
+					hash := BlockHash(in[i:end])
+					expected = append(expected, BlockInfo{Offset: int64(i), Length: int64(end - i), Hash: hash})
+					hashes = append(hashes, hash)
+				}
+				assert.Equal(t, expected, h.Blocks())
+				assert.Equal(t, hashes, h.BlockHashes())
+			})
+		}
+	}
+}
+
+func TestBlocksBeforeSum(t *testing.T) {
+	// Sum isn't needed first; the incomplete block so far is included.
+	in := sequentialInput(2*BlockSize + 100)
+	h := New().(Hasher)
+	h.Write(in)
+	expected := []BlockInfo{
+		{Offset: 0, Length: BlockSize, Hash: BlockHash(in[:BlockSize])},
+		{Offset: BlockSize, Length: BlockSize, Hash: BlockHash(in[BlockSize : 2*BlockSize])},
+		{Offset: 2 * BlockSize, Length: 100, Hash: BlockHash(in[2*BlockSize:])},
+	}
+	assert.Equal(t, expected, h.Blocks())
+	// And asking for them doesn't change anything.
+	assert.Equal(t, expected, h.Blocks())
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestBlockHashesAreCopied(t *testing.T) {
+	h := New().(Hasher)
+	h.Write([]byte("hello"))
+	h.Sum(nil)
+	hashes := h.BlockHashes()
+	h.Reset()
+	h.Write([]byte("world"))
+	h.Sum(nil)
+	assert.Equal(t, [][sha256.Size]byte{BlockHash([]byte("hello"))}, hashes)
+}
+
+func TestBlockHashTooLong(t *testing.T) {
+	assert.Panics(t, func() { BlockHash(make([]byte, BlockSize+1)) })
+}
+
+func TestPageHash(t *testing.T) {
+	in := sequentialInput(PageSize*PagesPerBlock - 1)
+	// Building a block up from the page hashes should give the same as hashing it directly.
+	h := sha256.New()
+	for i := 0; i < len(in); i += PageSize {
+		end := i + PageSize
+		if end > len(in) {
+			end = len(in)
+		}
+		page := PageHash(in[i:end])
+		h.Write(page[:])
+	}
+	expected := BlockHash(in)
+	assert.Equal(t, expected[:], h.Sum(nil))
+	assert.Panics(t, func() { PageHash(make([]byte, PageSize+1)) })
+}
+
+func TestBlockHashesMatchBlockHash(t *testing.T) {
+	// These should be exactly what BlockHash would give, so they can be used as a dedupe manifest.
+	in := sequentialInput(4*BlockSize + PageSize + 1)
+	h := New().(Hasher)
+	defer h.Close()
+	h.Write(in)
+	h.Sum(nil)
+	assert.Equal(t, blockHashesOf(in), h.BlockHashes())
+	assert.Equal(t, Sum(in), CombineBlockHashes(h.BlockHashes()))
+}
+
+func TestBlockHashesNotRecordedForOtherHashes(t *testing.T) {
+	h := NewPagedHash(sha512.New, BlockSize, PageSize, 2).(Hasher)
+	h.Write(sequentialInput(BlockSize + 1))
+	h.Sum(nil)
+	assert.Empty(t, h.BlockHashes())
+	assert.Empty(t, h.Blocks())
+}
+
+func TestBlockObserver(t *testing.T) {
+	in := sequentialInput(3*BlockSize + PageSize)
+	for _, cached := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Cached%v", cached), func(t *testing.T) {
+			var hashes [][sha256.Size]byte
+			opts := []Option{WithBlockObserver(func(index int, hash [sha256.Size]byte) {
+				assert.Equal(t, len(hashes), index)
+				hashes = append(hashes, hash)
+			})}
+			if cached {
+				opts = append(opts, WithBlockCache(newMapCache()))
+			}
+			h := New(opts...).(Hasher)
+			defer h.Close()
+			h.Write(in[:BlockSize-1])
+			assert.Empty(t, hashes)
+			h.Write(in[BlockSize-1 : BlockSize])
+			// The first block should be reported as soon as it's done.
+			assert.Equal(t, blockHashesOf(in[:BlockSize]), hashes)
+			h.Write(in[BlockSize:])
+			h.Sum(nil)
+			// The final short block isn't reported.
+			assert.Equal(t, blockHashesOf(in[:3*BlockSize]), hashes)
+		})
+	}
+}
+
+func TestBlocksAfterPanic(t *testing.T) {
+	h := newFailedHash(t)
+	assert.Nil(t, h.BlockHashes())
+	assert.Nil(t, h.Blocks())
+}
@@ -0,0 +1,45 @@
+package vsohash
+
+import (
+	"hash"
+)
+
+// Clone returns an independent copy of the hash in its current state. Writes to either one don't
+// affect the other, so this can be used to hash a common prefix once and then carry on with several
+// different suffixes.
+//
+// The copy has its own workers (with the same parallelism and options as the original), unless the
+// original was created from a Pool, in which case the copy shares the same pool. Any pages the original
+// is still hashing are waited for, so this may block briefly.
+func (v *vsoHash) Clone() hash.Hash {
+	v.resolveBlocks()
+	// This applies all the original's options to the copy.
+	opts := []Option{func(o *options) {
+		*o = v.opts
+	}}
+	blockSize := v.pageSize * v.pagesPerBlock
+	var c *vsoHash
+	if v.running == nil {
+		c = newUnstartedHash(v.newInner, blockSize, v.pageSize, v.suffix, opts)
+		c.tasks = v.tasks
+		c.pool = v.pool
+	} else if v.workers != nil {
+		c = newHash(v.newInner, blockSize, v.pageSize, len(v.workers), v.suffix, opts)
+	} else {
+		c = newHash(v.newInner, blockSize, v.pageSize, cap(v.tasks), v.suffix, opts)
+	}
+	c.buffer.Write(v.buffer.Bytes())
+	c.current.n = copy(c.current.pages, v.peekPages())
+	c.blobID.Write(v.blobID.Bytes())
+	c.blocks = v.blocks
+	c.written = v.written
+	c.blockHashes = append(c.blockHashes, v.blockHashes...)
+	c.block = append(c.block, v.block...)
+	c.reported = v.reported
+	c.pages = v.pages
+	c.err = v.err
+	if v.shadow != nil {
+		c.shadow = v.shadow.Clone().(*vsoHash)
+	}
+	return c
+}
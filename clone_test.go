@@ -0,0 +1,71 @@
+package vsohash
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClone(t *testing.T) {
+	prefix := sequentialInput(2*BlockSize + PageSize + 5)
+	a := []byte("the first suffix")
+	b := sequentialInput(BlockSize + 1)
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Default", nil},
+		{"Cached", []Option{WithBlockCache(newMapCache())}},
+		{"Affinity", []Option{WithAffinity(true)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := NewParallel(4, tc.opts...)
+			defer h.(io.Closer).Close()
+			h.Write(prefix)
+			c := h.(Hasher).Clone()
+			defer c.(io.Closer).Close()
+			h.Write(a)
+			c.Write(b)
+			assert.Equal(t, Sum(append(prefix, a...)), sumArray(h))
+			assert.Equal(t, Sum(append(prefix, b...)), sumArray(c))
+		})
+	}
+}
+
+func TestCloneAtBoundaries(t *testing.T) {
+	in := sequentialInput(2*BlockSize + 1)
+	for _, split := range []int{0, 1, PageSize - 1, PageSize, BlockSize, BlockSize + 1, len(in)} {
+		t.Run(fmt.Sprintf("Split%d", split), func(t *testing.T) {
+			h := New()
+			h.Write(in[:split])
+			c := h.(Hasher).Clone()
+			c.Write(in[split:])
+			assert.Equal(t, Sum(in[:split]), sumArray(h))
+			assert.Equal(t, Sum(in), sumArray(c))
+		})
+	}
+}
+
+func TestCloneFromPool(t *testing.T) {
+	p := NewPool(2)
+	defer p.Close()
+	in := sequentialInput(BlockSize + PageSize)
+	h := NewFromPool(p)
+	h.Write(in[:PageSize+1])
+	c := h.(Hasher).Clone()
+	assert.Equal(t, p.tasks, c.(*vsoHash).tasks)
+	c.Write(in[PageSize+1:])
+	assert.Equal(t, Sum(in), sumArray(c))
+}
+
+func TestClonePagedHash(t *testing.T) {
+	in := sequentialInput(2*BlockSize + 100)
+	h := NewPagedHash(sha512.New, BlockSize, PageSize, 2)
+	h.Write(in[:BlockSize+PageSize])
+	c := h.(Hasher).Clone()
+	c.Write(in[BlockSize+PageSize:])
+	assert.Equal(t, pagedSum(sha512.New(), in, BlockSize, PageSize), c.Sum(nil))
+}
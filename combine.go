@@ -0,0 +1,85 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+	"errors"
+)
+
+// IdentifierFromPageHashes computes the identifier of a blob from the SHA256 hashes of all its pages, in order.
+// This allows reconstructing the identifier from stored page-level metadata without needing the original content.
+// An empty list of pages corresponds to an empty blob.
+//
+// Since any list of page hashes describes some valid input, this can't currently fail; the error is reserved
+// so validation can be added later without changing the signature.
+func IdentifierFromPageHashes(pages [][sha256.Size]byte) ([Size]byte, error) {
+	v := newChain()
+	h := newSHA256()
+	for i := 0; i == 0 || i < len(pages); i += PagesPerBlock {
+		end := i + PagesPerBlock
+		if end > len(pages) {
+			end = len(pages)
+		}
+		h.Reset()
+		for _, page := range pages[i:end] {
+			h.Write(page[:])
+		}
+		var blockHash [sha256.Size]byte
+		v.updateBlobID(h.Sum(blockHash[:0]))
+	}
+	return v.identifier(), nil
+}
+
+// CombineBlockHashes computes the identifier of a blob from the hashes of all its blocks, in order (see BlockHash).
+// This allows an input to be split up at block boundaries and each block hashed separately (e.g. on different
+// machines), then the results combined into the identifier for the whole input.
+// An empty list of blocks corresponds to an empty blob.
+func CombineBlockHashes(blockHashes [][sha256.Size]byte) [Size]byte {
+	if len(blockHashes) == 0 {
+		// An empty blob is still one (empty) block.
+		blockHashes = [][sha256.Size]byte{BlockHash(nil)}
+	}
+	v := newChain()
+	for _, h := range blockHashes {
+		v.updateBlobID(h[:])
+	}
+	return v.identifier()
+}
+
+// newChain returns a hash that can only be used for the blob id calculations, i.e. for callers that
+// already have the block hashes and just need to combine them. It doesn't start any goroutines.
+func newChain() *vsoHash {
+	return &vsoHash{
+		inner:  newSHA256(),
+		suffix: []byte{0},
+	}
+}
+
+// Concat returns the identifier of the concatenation of everything written to left followed by everything
+// written to right, without needing any of it to be hashed again. This allows contiguous regions of an input
+// to be hashed in parallel and then combined.
+// It's only possible if left ends on a block boundary, since otherwise the blocks of right don't line up with
+// those of the whole input; it returns a *BlockAlignmentError if not. Neither hash is changed.
+// Both must be standard VSO-Hashes (i.e. from New, NewParallel etc, not NewPagedHash). If either has failed
+// or had its context cancelled, its error is returned (as for SumErr).
+func Concat(left, right Hasher) ([Size]byte, error) {
+	l, ok1 := left.(*vsoHash)
+	r, ok2 := right.(*vsoHash)
+	if !ok1 || !ok2 || !l.isVSOHash() || !r.isVSOHash() {
+		return [Size]byte{}, errors.New("vsohash: Concat can only be used with VSO-Hashes")
+	} else if l.written%BlockSize != 0 {
+		return [Size]byte{}, &BlockAlignmentError{Size: l.written}
+	}
+	lh, err := l.blockHashesErr()
+	if err != nil {
+		return [Size]byte{}, err
+	}
+	rh, err := r.blockHashesErr()
+	if err != nil {
+		return [Size]byte{}, err
+	} else if l.written == 0 {
+		return r.sum(), nil
+	} else if r.written == 0 {
+		return l.sum(), nil
+	}
+	return CombineBlockHashes(append(lh, rh...)), nil
+}
@@ -0,0 +1,107 @@
+package vsohash
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentifierFromPageHashes(t *testing.T) {
+	for _, lim := range []int{0, 1, PageSize - 1, PageSize, PageSize + 1, BlockSize, BlockSize + 1, 2*BlockSize + PageSize + 3} {
+		t.Run(fmt.Sprintf("Size%d", lim), func(t *testing.T) {
+			in := sequentialInput(lim)
+			id, err := IdentifierFromPageHashes(pageHashes(in))
+			require.NoError(t, err)
+			assert.Equal(t, Sum(in), id)
+		})
+	}
+}
+
+// pageHashes returns the hashes of each page of the given input.
+func pageHashes(in []byte) [][sha256.Size]byte {
+	var pages [][sha256.Size]byte
+	for i := 0; i < len(in); i += PageSize {
+		end := i + PageSize
+		if end > len(in) {
+			end = len(in)
+		}
+		pages = append(pages, sha256.Sum256(in[i:end]))
+	}
+	return pages
+}
+
+func TestCombineBlockHashes(t *testing.T) {
+	for lim, hash := range blobIDVectors {
+		t.Run(fmt.Sprintf("Size%d", lim), func(t *testing.T) {
+			id := CombineBlockHashes(blockHashesOf(sequentialInput(lim)))
+			assert.Equal(t, hash, hex.EncodeToString(id[:]))
+		})
+	}
+}
+
+func TestCombineNoBlockHashes(t *testing.T) {
+	assert.Equal(t, Sum(nil), CombineBlockHashes(nil))
+}
+
+func TestConcat(t *testing.T) {
+	in := sequentialInput(5*BlockSize + 17)
+	// The last one leaves only the short last block on the right.
+	for _, split := range []int{0, BlockSize, 3 * BlockSize, 5 * BlockSize} {
+		t.Run(fmt.Sprint(split), func(t *testing.T) {
+			left := New().(Hasher)
+			defer left.Close()
+			left.Write(in[:split])
+			right := New().(Hasher)
+			defer right.Close()
+			right.Write(in[split:])
+			sum, err := Concat(left, right)
+			require.NoError(t, err)
+			assert.Equal(t, Sum(in), sum)
+		})
+	}
+}
+
+func TestConcatEmptyRight(t *testing.T) {
+	in := sequentialInput(2 * BlockSize)
+	left := New().(Hasher)
+	left.Write(in)
+	sum, err := Concat(left, New().(Hasher))
+	require.NoError(t, err)
+	assert.Equal(t, Sum(in), sum)
+}
+
+func TestConcatUnaligned(t *testing.T) {
+	left := New().(Hasher)
+	left.Write(sequentialInput(BlockSize + 1))
+	_, err := Concat(left, New().(Hasher))
+	var alignErr *BlockAlignmentError
+	require.ErrorAs(t, err, &alignErr)
+	assert.EqualValues(t, BlockSize+1, alignErr.Size)
+	_, err = Concat(NewPagedHash(sha256.New, 4096, 1024, 1).(Hasher), New().(Hasher))
+	assert.Error(t, err)
+}
+
+func TestConcatAfterPanic(t *testing.T) {
+	ok := New().(Hasher)
+	ok.Write(sequentialInput(BlockSize))
+	var perr *PanicError
+	_, err := Concat(newFailedHash(t), ok)
+	assert.ErrorAs(t, err, &perr)
+	_, err = Concat(ok, newFailedHash(t))
+	assert.ErrorAs(t, err, &perr)
+}
+
+func TestConcatCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	left := NewWithContext(ctx, 4).(Hasher)
+	defer left.Close()
+	left.Write(sequentialInput(BlockSize))
+	cancel()
+	_, err := Concat(left, New().(Hasher))
+	assert.Equal(t, context.Canceled, err)
+}
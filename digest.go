@@ -0,0 +1,56 @@
+package vsohash
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// A Digest is a VSO-Hash identifier along with the size of the content it identifies, which content-addressed
+// stores generally need both of.
+type Digest struct {
+	Hash [Size]byte
+	Size int64
+}
+
+// String returns the digest as the identifier in the form produced by FormatIdentifier, then a slash and the size
+// (e.g. VSO0:1E57CF...6A00/0).
+func (d Digest) String() string {
+	return FormatIdentifier(d.Hash) + "/" + strconv.FormatInt(d.Size, 10)
+}
+
+// REAPIDigest mirrors the Digest message from the Bazel Remote Execution API, without depending on its generated
+// protobufs; callers copy the two fields across (e.g. &repb.Digest{Hash: d.Hash, SizeBytes: d.SizeBytes}).
+type REAPIDigest struct {
+	Hash      string
+	SizeBytes int64
+}
+
+// REAPI returns the digest in its Remote Execution API form. The hash is the whole 33-byte identifier as
+// lowercase hex (see ContentID.String), so it's 66 characters rather than the 64 of a SHA256 digest; that
+// includes the trailing algorithm byte, which servers that support VSO-Hash as a digest function expect.
+func (d Digest) REAPI() REAPIDigest {
+	return REAPIDigest{Hash: ContentID(d.Hash).String(), SizeBytes: d.Size}
+}
+
+// FromREAPI converts a Remote Execution API digest back into a Digest, checking that its hash is a valid identifier.
+func FromREAPI(d REAPIDigest) (Digest, error) {
+	id, err := decodeHex([]byte(d.Hash))
+	if err != nil {
+		return Digest{}, fmt.Errorf("vsohash: invalid digest hash %q: %w", d.Hash, err)
+	} else if d.SizeBytes < 0 {
+		return Digest{}, fmt.Errorf("vsohash: invalid digest size %d", d.SizeBytes)
+	}
+	return Digest{Hash: id, Size: d.SizeBytes}, nil
+}
+
+// SumDigest is like Sum but returns the result as a Digest.
+func SumDigest(in []byte) Digest {
+	return Digest{Hash: Sum(in), Size: int64(len(in))}
+}
+
+// DigestReader is like SumReader but returns the result as a Digest of everything read from r until EOF.
+func DigestReader(ctx context.Context, r io.Reader, opts ...Option) (Digest, error) {
+	return digestReader(r, append(opts, withContext(ctx))...)
+}
@@ -0,0 +1,53 @@
+package vsohash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSumDigest(t *testing.T) {
+	in := sequentialInput(BlockSize + 1)
+	d := SumDigest(in)
+	assert.Equal(t, Sum(in), d.Hash)
+	assert.EqualValues(t, BlockSize+1, d.Size)
+	assert.Equal(t, "VSO0:1E57CF2792A900D06C1CDFB3C453F35BC86F72788AA9724C96C929D1CC6B456A00/0", SumDigest(nil).String())
+}
+
+func TestDigestReader(t *testing.T) {
+	in := sequentialInput(2*BlockSize + PageSize + 3)
+	d, err := DigestReader(context.Background(), bytes.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, SumDigest(in), d)
+}
+
+func TestDigestReaderError(t *testing.T) {
+	kaboom := errors.New("kaboom")
+	_, err := DigestReader(context.Background(), io.MultiReader(bytes.NewReader([]byte("header")), &errorReader{err: kaboom}))
+	assert.Equal(t, kaboom, err)
+	_, err = DigestReader(context.Background(), bytes.NewReader(nil), WithRejectEmpty(true))
+	assert.Equal(t, ErrEmptyInput, err)
+}
+
+func TestREAPI(t *testing.T) {
+	d := SumDigest([]byte("hello"))
+	r := d.REAPI()
+	assert.Len(t, r.Hash, 66)
+	assert.Equal(t, SumHex([]byte("hello")), r.Hash)
+	assert.EqualValues(t, 5, r.SizeBytes)
+	d2, err := FromREAPI(r)
+	require.NoError(t, err)
+	assert.Equal(t, d, d2)
+}
+
+func TestFromREAPIInvalid(t *testing.T) {
+	_, err := FromREAPI(REAPIDigest{Hash: SumHex(nil)[:64]})
+	assert.Error(t, err)
+	_, err = FromREAPI(REAPIDigest{Hash: SumHex(nil), SizeBytes: -1})
+	assert.Error(t, err)
+}
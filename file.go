@@ -0,0 +1,83 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// ErrFileChanged is returned by SumFile if it detects that the file changed size while it was being hashed.
+var ErrFileChanged = errors.New("vsohash: file changed while being hashed")
+
+// SumFile calculates the VSO-Hash of the file at the given path.
+// Regular files are read in parallel (as SumReaderAt), using up to GOMAXPROCS goroutines (or as many as
+// given to WithParallelism); anything else (e.g. a pipe) is read sequentially.
+//
+// With WithMmap, large files are memory-mapped instead. If a mapped file is truncated while being
+// hashed, ErrFileChanged is returned (rather than the process crashing, which is otherwise what happens
+// when accessing mapped memory beyond the end of the file).
+func SumFile(path string, opts ...Option) ([Size]byte, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return [Size]byte{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return [Size]byte{}, err
+	} else if !info.Mode().IsRegular() {
+		return sumReader(f, opts...)
+	}
+	size := info.Size()
+	if o.mmap && size >= BlockSize {
+		if data, err := mmap(f, size); err == nil {
+			defer munmap(data)
+			return o.sumMapped(f, data)
+		}
+	}
+	return SumReaderAt(f, size, o.fileParallelism(), opts...)
+}
+
+// fileParallelism returns the number of blocks SumFile hashes at once.
+func (o *options) fileParallelism() int {
+	if o.parallelism > 0 {
+		return o.parallelism
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// sumMapped calculates the VSO-Hash of the given mapped file contents.
+func (o *options) sumMapped(f *os.File, data []byte) ([Size]byte, error) {
+	size := int64(len(data))
+	sum, err := o.sumBlocks(size, o.fileParallelism(), 0, func(buf []byte, offset, length int64) (h [sha256.Size]byte, err error) {
+		// If the file is truncated underneath us, we'll get a fault reading the mapped memory.
+		// Ask the runtime to turn it into a panic that we can recover from.
+		defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(interface{ Addr() uintptr }); !ok {
+					panic(r) // Not a memory fault, so not something we should be hiding.
+				}
+				err = fmt.Errorf("%w: %s", ErrFileChanged, r)
+			}
+		}()
+		return o.hashBlock(data[offset : offset+length]), nil
+	})
+	if err != nil {
+		return sum, err
+	}
+	// Even if we didn't fault, the file could have been truncated and re-extended; check it's still the same size.
+	if info, err := f.Stat(); err != nil {
+		return [Size]byte{}, err
+	} else if info.Size() != size {
+		return [Size]byte{}, ErrFileChanged
+	}
+	return sum, nil
+}
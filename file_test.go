@@ -0,0 +1,73 @@
+package vsohash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSumFile(t *testing.T) {
+	for _, lim := range []int{0, 1, PageSize + 1, BlockSize, 2*BlockSize + PageSize + 1} {
+		for _, mmap := range []bool{false, true} {
+			t.Run(fmt.Sprintf("Size%dMmap%v", lim, mmap), func(t *testing.T) {
+				in := sequentialInput(lim)
+				filename := filepath.Join(t.TempDir(), "input")
+				require.NoError(t, os.WriteFile(filename, in, 0644))
+				sum, err := SumFile(filename, WithMmap(mmap))
+				require.NoError(t, err)
+				assert.Equal(t, Sum(in), sum)
+			})
+		}
+	}
+}
+
+func TestSumFileParallelism(t *testing.T) {
+	var o options
+	assert.Equal(t, runtime.GOMAXPROCS(0), o.fileParallelism())
+	WithParallelism(3)(&o)
+	assert.Equal(t, 3, o.fileParallelism())
+
+	in := sequentialInput(3*BlockSize + 1)
+	filename := filepath.Join(t.TempDir(), "input")
+	require.NoError(t, os.WriteFile(filename, in, 0644))
+	for _, mmap := range []bool{false, true} {
+		sum, err := SumFile(filename, WithMmap(mmap), WithParallelism(2))
+		require.NoError(t, err)
+		assert.Equal(t, Sum(in), sum)
+	}
+}
+
+func TestSumFileMissing(t *testing.T) {
+	_, err := SumFile(filepath.Join(t.TempDir(), "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSumFileMappedTruncated(t *testing.T) {
+	// Simulate the file being truncated after it's been mapped.
+	in := sequentialInput(2 * BlockSize)
+	filename := filepath.Join(t.TempDir(), "input")
+	require.NoError(t, os.WriteFile(filename, in, 0644))
+	f, err := os.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+	data, err := mmap(f, int64(len(in)))
+	if err != nil {
+		t.Skipf("mmap not supported: %s", err)
+	}
+	defer munmap(data)
+	require.NoError(t, os.Truncate(filename, PageSize))
+	var o options
+	_, err = o.sumMapped(f, data)
+	assert.ErrorIs(t, err, ErrFileChanged)
+}
+
+func TestSumFileDirectory(t *testing.T) {
+	// Directories aren't regular files so get read sequentially; that should fail rather than hashing nothing.
+	_, err := SumFile(t.TempDir())
+	assert.Error(t, err)
+}
@@ -2,9 +2,15 @@ module github.com/peterebden/vso-hash
 
 go 1.18
 
+require (
+	github.com/minio/sha256-simd v1.0.1
+	github.com/stretchr/testify v1.7.0
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/klauspost/cpuid/v2 v2.2.3 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.7.0 // indirect
+	golang.org/x/sys v0.0.0-20220704084225-05e143d24a9e // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
 )
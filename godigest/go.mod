@@ -0,0 +1,18 @@
+module github.com/peterebden/vso-hash/godigest
+
+go 1.18
+
+require (
+	github.com/opencontainers/go-digest v1.0.0
+	github.com/peterebden/vso-hash v0.0.0-20261014105316-cad875cd3179
+	github.com/stretchr/testify v1.7.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/klauspost/cpuid/v2 v2.2.3 // indirect
+	github.com/minio/sha256-simd v1.0.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.0.0-20220704084225-05e143d24a9e // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+)
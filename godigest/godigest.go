@@ -0,0 +1,119 @@
+// Package godigest provides VSO-Hash as an algorithm for github.com/opencontainers/go-digest.
+//
+// It lives in its own module so that users of the main package don't pick up a dependency on go-digest.
+//
+// go-digest v1.0.0 only knows about the algorithms registered with the standard crypto package, and has no way to
+// add more; hence Algorithm.Available returns false for Algorithm and digest.Digest's Validate and Verifier
+// methods don't work on its digests. The functions here are the equivalents that do.
+package godigest
+
+import (
+	"encoding/hex"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+
+	vsohash "github.com/peterebden/vso-hash"
+)
+
+// Algorithm is the go-digest algorithm name for VSO-Hash. Digests are of the form vso0:<hex>, where the hex is
+// lowercase and covers the whole identifier (including the trailing algorithm byte), so it's always 66 characters.
+const Algorithm digest.Algorithm = "vso0"
+
+// Digester returns a new digest.Digester that computes VSO-Hash digests.
+// It hashes in parallel, so it also implements io.Closer; close it once it's no longer needed to release its
+// worker goroutines (otherwise they're only released once it's garbage collected).
+func Digester() digest.Digester {
+	return &digester{hash: vsohash.New()}
+}
+
+type digester struct {
+	hash hash.Hash
+}
+
+func (d *digester) Hash() hash.Hash {
+	return d.hash
+}
+
+func (d *digester) Digest() digest.Digest {
+	return digest.NewDigest(Algorithm, d.hash)
+}
+
+func (d *digester) Close() error {
+	return d.hash.(io.Closer).Close()
+}
+
+// FromBytes returns the digest of the given bytes.
+func FromBytes(p []byte) digest.Digest {
+	id := vsohash.Sum(p)
+	return digest.NewDigestFromEncoded(Algorithm, hex.EncodeToString(id[:]))
+}
+
+// FromString returns the digest of the given string.
+func FromString(s string) digest.Digest {
+	return FromBytes([]byte(s))
+}
+
+// FromReader returns the digest of everything read from r until EOF.
+func FromReader(r io.Reader) (digest.Digest, error) {
+	d := Digester()
+	defer d.(io.Closer).Close()
+	if _, err := io.Copy(d.Hash(), r); err != nil {
+		return "", err
+	}
+	return d.Digest(), nil
+}
+
+// Validate checks that d is a valid VSO-Hash digest. It returns the same errors that digest.Digest.Validate
+// does for other algorithms.
+func Validate(d digest.Digest) error {
+	s := string(d)
+	i := strings.IndexByte(s, ':')
+	if i <= 0 || i+1 == len(s) {
+		return digest.ErrDigestInvalidFormat
+	} else if digest.Algorithm(s[:i]) != Algorithm {
+		return digest.ErrDigestUnsupported
+	}
+	encoded := s[i+1:]
+	if len(encoded) != hex.EncodedLen(vsohash.Size) {
+		return digest.ErrDigestInvalidLength
+	} else if strings.ToLower(encoded) != encoded || !vsohash.IsValid(decode(encoded)) {
+		return digest.ErrDigestInvalidFormat
+	}
+	return nil
+}
+
+// decode decodes the given hex, returning nil if it isn't valid.
+func decode(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// Verifier returns a digest.Verifier that checks content written to it against d, which should be a valid
+// VSO-Hash digest (see Validate); if it isn't, Verified always returns false.
+// Like Digester, it implements io.Closer and should be closed once it's no longer needed.
+func Verifier(d digest.Digest) digest.Verifier {
+	return &verifier{expected: d, digester: Digester()}
+}
+
+type verifier struct {
+	expected digest.Digest
+	digester digest.Digester
+}
+
+func (v *verifier) Write(p []byte) (int, error) {
+	return v.digester.Hash().Write(p)
+}
+
+func (v *verifier) Verified() bool {
+	return v.digester.Digest() == v.expected
+}
+
+func (v *verifier) Close() error {
+	return v.digester.(io.Closer).Close()
+}
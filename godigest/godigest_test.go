@@ -0,0 +1,59 @@
+package godigest
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const emptyDigest = digest.Digest("vso0:1e57cf2792a900d06c1cdfb3c453f35bc86f72788aa9724c96c929d1cc6b456a00")
+
+func TestFromBytes(t *testing.T) {
+	assert.Equal(t, emptyDigest, FromBytes(nil))
+	assert.Equal(t, Algorithm, FromString("hello").Algorithm())
+	assert.NoError(t, Validate(FromString("hello")))
+}
+
+func TestFromReader(t *testing.T) {
+	in := bytes.Repeat([]byte("abcdefgh"), 300000)
+	d, err := FromReader(bytes.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, FromBytes(in), d)
+}
+
+func TestValidate(t *testing.T) {
+	s := string(emptyDigest)
+	assert.NoError(t, Validate(emptyDigest))
+	assert.Equal(t, digest.ErrDigestInvalidFormat, Validate(digest.Digest("vso0")))
+	assert.Equal(t, digest.ErrDigestUnsupported, Validate(digest.Digest("sha256:"+s[5:])))
+	assert.Equal(t, digest.ErrDigestInvalidLength, Validate(digest.Digest(s[:len(s)-2])))
+	assert.Equal(t, digest.ErrDigestInvalidFormat, Validate(digest.Digest(s[:len(s)-2]+"01")))
+	assert.Equal(t, digest.ErrDigestInvalidFormat, Validate(digest.Digest("vso0:1E"+s[7:])))
+}
+
+func TestVerifier(t *testing.T) {
+	v := Verifier(FromString("hello"))
+	v.Write([]byte("hel"))
+	v.Write([]byte("lo"))
+	assert.True(t, v.Verified())
+	v = Verifier(FromString("hello"))
+	v.Write([]byte("world"))
+	assert.False(t, v.Verified())
+}
+
+func TestClose(t *testing.T) {
+	d := Digester()
+	d.Hash().Write([]byte("hello"))
+	dg := d.Digest()
+	assert.NoError(t, d.(io.Closer).Close())
+	// It's still usable for the result afterwards, just not for more input.
+	assert.Equal(t, FromString("hello"), dg)
+	v := Verifier(dg)
+	v.Write([]byte("hello"))
+	assert.True(t, v.Verified())
+	assert.NoError(t, v.(io.Closer).Close())
+}
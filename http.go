@@ -0,0 +1,141 @@
+package vsohash
+
+import (
+	"io"
+	"net/http"
+)
+
+// A Transport is an http.RoundTripper that calculates the VSO-Hash of each response body as it's read.
+// The bodies aren't buffered; each response's Body is replaced with a *Body that hashes it on the way
+// through (use ResponseBody to get at it once it's been read).
+type Transport struct {
+	// The underlying RoundTripper that makes the requests. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+	// If set, this is called with each response to find the identifier its body should have (e.g. from a
+	// header). If it returns false the body is still hashed, but not verified.
+	Expected func(resp *http.Response) ([Size]byte, bool)
+	// Options for the hash of each body.
+	Options []Option
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body := NewBody(resp.Body, t.Options...)
+	if t.Expected != nil {
+		if expected, ok := t.Expected(resp); ok {
+			body.Expect(expected)
+		}
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// ResponseBody returns the Body of a response from a Transport, or nil if it didn't come from one.
+func ResponseBody(resp *http.Response) *Body {
+	body, _ := resp.Body.(*Body)
+	return body
+}
+
+// A Body wraps an HTTP body (or any other io.ReadCloser) and calculates the VSO-Hash of everything read from it.
+type Body struct {
+	body     io.ReadCloser
+	h        *vsoHash
+	expected [Size]byte
+	verify   bool
+	// Once set, this is returned from every subsequent Read.
+	err error
+}
+
+// NewBody returns a new Body that reads from the given one.
+// It must be closed once it's finished with, which closes the underlying body too.
+func NewBody(body io.ReadCloser, opts ...Option) *Body {
+	return &Body{body: body, h: New(opts...).(*vsoHash)}
+}
+
+// Expect sets the identifier the body is expected to have. Once the underlying body reaches EOF, Read
+// returns ErrHashMismatch instead of io.EOF if what was read doesn't have it.
+// It must be called before the body is read.
+func (b *Body) Expect(expected [Size]byte) {
+	b.expected = expected
+	b.verify = true
+}
+
+// Read implements io.Reader. Errors from the underlying body are returned unchanged.
+func (b *Body) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.body.Read(p)
+	if _, err := b.h.Write(p[:n]); err != nil {
+		b.err = err
+		return n, err
+	}
+	if err == io.EOF && b.verify && !verify(b.h.sum(), b.expected) {
+		err = ErrHashMismatch
+	}
+	if err != nil {
+		b.err = err
+	}
+	return n, err
+}
+
+// Sum returns the identifier of everything read so far, which is the whole body once Read has returned io.EOF.
+func (b *Body) Sum() ([Size]byte, error) {
+	return b.h.SumErr()
+}
+
+// Close closes the underlying body and releases the hash. Sum can still be called afterwards.
+func (b *Body) Close() error {
+	b.h.Close()
+	return b.body.Close()
+}
+
+// ServeHash serves the request with handler, passing it a ResponseWriter that hashes everything written to w,
+// and returns the identifier of the body it served once it's done. That lets a server record what it actually
+// sent without another pass over it.
+// Only what w accepts is hashed, so if writing to the client fails partway through the result is of exactly
+// what was written. The writer passed to the handler implements http.Flusher only if w does. It doesn't
+// support http.Hijacker, and can't be unwrapped to get at w, since anything written to w directly (or to a
+// hijacked connection) couldn't be hashed.
+func ServeHash(handler http.Handler, w http.ResponseWriter, r *http.Request, opts ...Option) ([Size]byte, error) {
+	hw := &hashingResponseWriter{ResponseWriter: w, h: New(opts...).(*vsoHash)}
+	defer hw.h.Close()
+	if f, ok := w.(http.Flusher); ok {
+		handler.ServeHTTP(&flushingResponseWriter{hashingResponseWriter: hw, f: f}, r)
+	} else {
+		handler.ServeHTTP(hw, r)
+	}
+	return hw.h.SumErr()
+}
+
+type hashingResponseWriter struct {
+	http.ResponseWriter
+	h *vsoHash
+}
+
+func (w *hashingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	if _, err := w.h.Write(p[:n]); err != nil {
+		return n, err
+	}
+	return n, err
+}
+
+// A flushingResponseWriter is a hashingResponseWriter for an underlying writer that's an http.Flusher.
+type flushingResponseWriter struct {
+	*hashingResponseWriter
+	f http.Flusher
+}
+
+// Flush implements http.Flusher.
+func (w *flushingResponseWriter) Flush() {
+	w.f.Flush()
+}
@@ -0,0 +1,128 @@
+package vsohash
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, body []byte) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Id", FormatIdentifier(Sum(body)))
+		w.Header().Set("X-Wrong-Id", FormatIdentifier(EmptyHash))
+		w.Write(body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestTransport(t *testing.T) {
+	in := sequentialInput(BlockSize + PageSize + 17)
+	s := newTestServer(t, in)
+	client := &http.Client{Transport: &Transport{}}
+	resp, err := client.Get(s.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, in, b)
+	sum, err := ResponseBody(resp).Sum()
+	require.NoError(t, err)
+	assert.Equal(t, Sum(in), sum)
+}
+
+func TestTransportVerifies(t *testing.T) {
+	in := sequentialInput(PageSize + 17)
+	s := newTestServer(t, in)
+	get := func(header string) error {
+		client := &http.Client{Transport: &Transport{
+			Expected: func(resp *http.Response) ([Size]byte, bool) {
+				id, err := Parse(resp.Header.Get(header))
+				return id, err == nil
+			},
+		}}
+		resp, err := client.Get(s.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		_, err = io.ReadAll(resp.Body)
+		return err
+	}
+	assert.NoError(t, get("X-Content-Id"))
+	assert.Equal(t, ErrHashMismatch, get("X-Wrong-Id"))
+	assert.NoError(t, get("X-Missing-Id")) // Not verified at all
+}
+
+func TestBodyPropagatesErrors(t *testing.T) {
+	kaboom := errors.New("kaboom")
+	b := NewBody(io.NopCloser(&errorReader{err: kaboom}))
+	defer b.Close()
+	_, err := b.Read(make([]byte, 10))
+	assert.Equal(t, kaboom, err)
+	_, err = b.Read(make([]byte, 10))
+	assert.Equal(t, kaboom, err)
+}
+
+func TestResponseBodyNotFromTransport(t *testing.T) {
+	assert.Nil(t, ResponseBody(&http.Response{Body: http.NoBody}))
+}
+
+func TestServeHash(t *testing.T) {
+	in := sequentialInput(BlockSize + PageSize + 17)
+	sums := make(chan [Size]byte, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sum, err := ServeHash(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(in[:PageSize+3])
+			w.(http.Flusher).Flush()
+			_, isHijacker := w.(http.Hijacker)
+			assert.False(t, isHijacker)
+			w.Write(in[PageSize+3:])
+		}), w, r)
+		assert.NoError(t, err)
+		sums <- sum
+	}))
+	defer s.Close()
+	resp, err := http.Get(s.URL)
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, in, b)
+	assert.Equal(t, Sum(in), <-sums)
+}
+
+// plainResponseWriter is an http.ResponseWriter that doesn't implement any of the optional interfaces.
+type plainResponseWriter struct {
+	http.ResponseWriter
+}
+
+func TestServeHashInterfaces(t *testing.T) {
+	for name, w := range map[string]http.ResponseWriter{
+		"Flusher":    httptest.NewRecorder(),
+		"NotFlusher": plainResponseWriter{ResponseWriter: httptest.NewRecorder()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, wantFlusher := w.(http.Flusher)
+			ServeHash(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, isFlusher := w.(http.Flusher)
+				assert.Equal(t, wantFlusher, isFlusher)
+				_, isHijacker := w.(http.Hijacker)
+				assert.False(t, isHijacker)
+				_, isUnwrapper := w.(interface{ Unwrap() http.ResponseWriter })
+				assert.False(t, isUnwrapper)
+			}), w, httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+	}
+}
+
+func TestServeHashRecorder(t *testing.T) {
+	w := httptest.NewRecorder()
+	sum, err := ServeHash(http.NotFoundHandler(), w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, Sum(w.Body.Bytes()), sum)
+}
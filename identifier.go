@@ -0,0 +1,211 @@
+package vsohash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// identifierPrefix is the prefix used by BuildXL for the string form of a VSO-Hash identifier.
+const identifierPrefix = "VSO0:"
+
+// EmptyHash is the VSO-Hash of empty input (1e57cf...6a00). It's often used to indicate "no content".
+var EmptyHash = [Size]byte{
+	0x1e, 0x57, 0xcf, 0x27, 0x92, 0xa9, 0x00, 0xd0, 0x6c, 0x1c, 0xdf, 0xb3, 0xc4, 0x53, 0xf3, 0x5b,
+	0xc8, 0x6f, 0x72, 0x78, 0x8a, 0xa9, 0x72, 0x4c, 0x96, 0xc9, 0x29, 0xd1, 0xcc, 0x6b, 0x45, 0x6a,
+	0x00,
+}
+
+// IsEmpty returns true if the given identifier is that of empty input (i.e. it's EmptyHash).
+func IsEmpty(h [Size]byte) bool {
+	return h == EmptyHash
+}
+
+// A ContentID is a VSO-Hash identifier, as returned by Sum.
+type ContentID [Size]byte
+
+// SumID is like Sum but returns the result as a ContentID.
+func SumID(in []byte) ContentID {
+	return ContentID(Sum(in))
+}
+
+// SumHex is like Sum but returns the result as lowercase hex (see ContentID.String).
+func SumHex(in []byte) string {
+	return SumID(in).String()
+}
+
+// SumBase64 is like Sum but returns the result as base64 (see ContentID.Base64).
+func SumBase64(in []byte) string {
+	return SumID(in).Base64()
+}
+
+// String returns the identifier as lowercase hex, including the trailing algorithm byte.
+func (id ContentID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Base64 returns the identifier encoded as base64, including the trailing algorithm byte.
+// This uses the standard alphabet from RFC 4648 (i.e. with + and /, not the URL-safe one), which is what
+// .NET's Convert.ToBase64String produces and hence what BuildXL and related tooling expect.
+// Identifiers are a multiple of 3 bytes long, so there's never any padding; the result is always 44 characters.
+func (id ContentID) Base64() string {
+	return base64.StdEncoding.EncodeToString(id[:])
+}
+
+// WriteTo implements io.WriterTo, writing the identifier's raw bytes (including the trailing algorithm byte) to w.
+func (id ContentID) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(id[:])
+	if err == nil && n != Size {
+		err = io.ErrShortWrite
+	}
+	return int64(n), err
+}
+
+// EncodeBase64 writes the identifier to w as base64, in the same encoding as ContentID.Base64, without
+// building an intermediate string. This is handy when writing out large manifests.
+func EncodeBase64(w io.Writer, h [Size]byte) error {
+	var b [44]byte
+	base64.StdEncoding.Encode(b[:], h[:])
+	_, err := w.Write(b[:])
+	return err
+}
+
+// EncodeHex is like EncodeBase64 but writes the identifier as lowercase hex, as ContentID.String does.
+func EncodeHex(w io.Writer, h [Size]byte) error {
+	var b [2 * Size]byte
+	hex.Encode(b[:], h[:])
+	_, err := w.Write(b[:])
+	return err
+}
+
+// MarshalText implements encoding.TextMarshaler. The encoding is the same as String.
+func (id ContentID) MarshalText() ([]byte, error) {
+	b := make([]byte, hex.EncodedLen(Size))
+	hex.Encode(b, id[:])
+	return b, nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts the same encoding as MarshalText produces
+// (either case of hex is fine) and rejects anything that isn't a valid identifier (see IsValid).
+func (id *ContentID) UnmarshalText(text []byte) error {
+	b, err := decodeHex(text)
+	if err != nil {
+		return fmt.Errorf("vsohash: invalid content id %q: %w", text, err)
+	}
+	*id = b
+	return nil
+}
+
+// decodeHex decodes a hex identifier, checking that it's a valid one.
+func decodeHex(text []byte) (ContentID, error) {
+	var id ContentID
+	if len(text) != hex.EncodedLen(Size) {
+		return id, fmt.Errorf("must be %d hex characters", hex.EncodedLen(Size))
+	} else if _, err := hex.Decode(id[:], text); err != nil {
+		return id, err
+	} else if err := checkAlgorithm(id); err != nil {
+		return id, err
+	}
+	return id, nil
+}
+
+// Set implements flag.Value, so a ContentID can be given as a command-line flag with flag.Var.
+// It accepts either the form produced by FormatIdentifier or plain hex (as String produces).
+func (id *ContentID) Set(s string) error {
+	if strings.HasPrefix(s, identifierPrefix) {
+		b, err := Parse(s)
+		if err != nil {
+			return err
+		}
+		*id = b
+		return nil
+	}
+	return id.UnmarshalText([]byte(s))
+}
+
+// FormatIdentifier returns the canonical string form of the given identifier as used by BuildXL and Azure Artifacts,
+// i.e. VSO0: followed by the identifier as uppercase hex (including the trailing algorithm byte).
+func FormatIdentifier(id [Size]byte) string {
+	return identifierPrefix + strings.ToUpper(hex.EncodeToString(id[:]))
+}
+
+// Parse parses an identifier in the form produced by FormatIdentifier. The hex may be in either case,
+// but the prefix must be exactly as given there.
+func Parse(s string) ([Size]byte, error) {
+	if !strings.HasPrefix(s, identifierPrefix) {
+		return [Size]byte{}, fmt.Errorf("vsohash: invalid identifier %q: missing %s prefix", s, identifierPrefix)
+	}
+	id, err := decodeHex([]byte(s[len(identifierPrefix):]))
+	if err != nil {
+		return [Size]byte{}, fmt.Errorf("vsohash: invalid identifier %q: %w", s, err)
+	}
+	return id, nil
+}
+
+// Uint64 returns a 64-bit fingerprint of the identifier (its first 8 bytes, interpreted as little-endian).
+// This is useful as a compact key for in-memory indexes or as input to a bloom filter.
+//
+// Since the identifier is a SHA256 output the fingerprint is uniformly distributed, but being only 64 bits
+// collisions become likely once there are around 2^32 (4 billion) distinct entries, and are possible well
+// before that. Anything using it as a key must confirm a match against the full identifier.
+func (id ContentID) Uint64() uint64 {
+	return binary.LittleEndian.Uint64(id[:8])
+}
+
+// Compare compares two identifiers by their bytes, returning -1, 0 or 1 if a is less than, equal to or
+// greater than b. That's also the order of their hex encodings, so sorting by it is the same as sorting
+// by String.
+func Compare(a, b ContentID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// ByContentID implements sort.Interface to sort identifiers in the order given by Compare, e.g. to give
+// generated manifests a reproducible order.
+type ByContentID []ContentID
+
+func (ids ByContentID) Len() int           { return len(ids) }
+func (ids ByContentID) Less(i, j int) bool { return Compare(ids[i], ids[j]) < 0 }
+func (ids ByContentID) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
+
+// IsValid returns true if the given bytes look like a VSO-Hash identifier, i.e. they're the right length
+// and end in the VSO-Hash algorithm byte. It doesn't (and can't) check that they're the hash of anything.
+// This is useful to cheaply distinguish these from other hashes (notably a plain SHA256, which is one byte shorter).
+func IsValid(b []byte) bool {
+	return len(b) == Size && b[Size-1] == AlgorithmID
+}
+
+// AlgorithmID is the algorithm byte that VSO-Hash identifiers end with.
+const AlgorithmID byte = 0
+
+// SHA256Part returns the SHA256 part of the given identifier (i.e. without the trailing algorithm byte).
+// That's useful for storing it in something that wants 32-byte keys.
+func SHA256Part(h [Size]byte) [sha256.Size]byte {
+	var ret [sha256.Size]byte
+	copy(ret[:], h[:sha256.Size])
+	return ret
+}
+
+// AlgorithmByte returns the algorithm byte at the end of the given identifier. For a VSO-Hash this is always AlgorithmID.
+func AlgorithmByte(h [Size]byte) byte {
+	return h[Size-1]
+}
+
+// CheckAlgorithm returns an error if the given identifier doesn't end with the VSO-Hash algorithm byte.
+func CheckAlgorithm(h [Size]byte) error {
+	if err := checkAlgorithm(h); err != nil {
+		return fmt.Errorf("vsohash: %w", err)
+	}
+	return nil
+}
+
+func checkAlgorithm(h [Size]byte) error {
+	if b := AlgorithmByte(h); b != AlgorithmID {
+		return fmt.Errorf("unknown algorithm byte %d", b)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package vsohash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	a := SumID([]byte("a"))
+	b := a
+	b[5]++
+	assert.Equal(t, -1, Compare(a, b))
+	assert.Equal(t, 1, Compare(b, a))
+	assert.Equal(t, 0, Compare(a, a))
+}
+
+func TestSortByContentID(t *testing.T) {
+	ids := []ContentID{SumID([]byte("a")), SumID([]byte("b")), SumID([]byte("c")), SumID(nil)}
+	sort.Sort(ByContentID(ids))
+	for i := 1; i < len(ids); i++ {
+		assert.Less(t, ids[i-1].String(), ids[i].String())
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	sum := Sum([]byte("hello"))
+	assert.True(t, IsValid(sum[:]))
+	assert.False(t, IsValid(nil))
+	assert.False(t, IsValid(sum[:sha256.Size]))
+	sha := sha256.Sum256([]byte("hello"))
+	assert.False(t, IsValid(sha[:]))
+	assert.False(t, IsValid(append(sum[:], 0)))
+	sum[Size-1] = 1
+	assert.False(t, IsValid(sum[:]))
+}
+
+func TestIsValidDoesNotAllocate(t *testing.T) {
+	sum := Sum([]byte("hello"))
+	assert.Zero(t, testing.AllocsPerRun(100, func() { IsValid(sum[:]) }))
+}
+
+func TestUint64(t *testing.T) {
+	id := ContentID(Sum(nil)) // 1e57cf2792a900d0...
+	assert.Equal(t, uint64(0xd000a99227cf571e), id.Uint64())
+}
+
+func TestContentIDString(t *testing.T) {
+	assert.Equal(t, "1e57cf2792a900d06c1cdfb3c453f35bc86f72788aa9724c96c929d1cc6b456a00", SumID(nil).String())
+}
+
+func TestContentIDJSON(t *testing.T) {
+	type doc struct {
+		ID ContentID `json:"id"`
+	}
+	in := doc{ID: SumID(sequentialInput(BlockSize + 1))}
+	b, err := json.Marshal(in)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id":"1f9f3c008ea37ecb65bc5fb14a420cebb3ca72a9601ec056709a6b431f91807100"}`, string(b))
+	var out doc
+	require.NoError(t, json.Unmarshal(b, &out))
+	assert.Equal(t, in, out)
+}
+
+func TestContentIDUnmarshalText(t *testing.T) {
+	var id ContentID
+	assert.NoError(t, id.UnmarshalText([]byte("1E57CF2792A900D06C1CDFB3C453F35BC86F72788AA9724C96C929D1CC6B456A00")))
+	assert.Equal(t, SumID(nil), id)
+	assert.Error(t, id.UnmarshalText([]byte("1e57cf2792a900d06c1cdfb3c453f35bc86f72788aa9724c96c929d1cc6b456a")))
+	assert.Error(t, id.UnmarshalText([]byte("1e57cf2792a900d06c1cdfb3c453f35bc86f72788aa9724c96c929d1cc6b456a0z")))
+	assert.Error(t, id.UnmarshalText([]byte("1e57cf2792a900d06c1cdfb3c453f35bc86f72788aa9724c96c929d1cc6b456a01")))
+	// Failures leave the existing value alone.
+	assert.Equal(t, SumID(nil), id)
+}
+
+func TestContentIDFlag(t *testing.T) {
+	var id ContentID
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(&id, "id", "content id")
+	require.NoError(t, fs.Parse([]string{"-id", FormatIdentifier(SumID([]byte("hello")))}))
+	assert.Equal(t, SumID([]byte("hello")), id)
+	require.NoError(t, fs.Parse([]string{"-id", SumHex(nil)}))
+	assert.Equal(t, SumID(nil), id)
+	assert.Error(t, fs.Parse([]string{"-id", "VSO0:1234"}))
+	assert.Error(t, fs.Parse([]string{"-id", "1e57cf2792a900d06c1cdfb3c453f35bc86f72788aa9724c96c929d1cc6b456a01"}))
+	assert.Equal(t, SumID(nil), id)
+}
+
+func TestSumHex(t *testing.T) {
+	assert.Equal(t, blobIDVectors[BlockSize+1], SumHex(sequentialInput(BlockSize+1)))
+}
+
+func TestSumBase64(t *testing.T) {
+	// This one's been chosen to include a + to check we're using the standard alphabet.
+	assert.Equal(t, "H588AI6jfstlvF+xSkIM67PKcqlgHsBWcJprQx+RgHEA", SumBase64(sequentialInput(BlockSize+1)))
+}
+
+func TestWriteTo(t *testing.T) {
+	id := SumID(sequentialInput(BlockSize + 1))
+	var buf bytes.Buffer
+	n, err := id.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.EqualValues(t, Size, n)
+	assert.Equal(t, id[:], buf.Bytes())
+	n, err = id.WriteTo(&errorWriter{io.ErrClosedPipe})
+	assert.Equal(t, io.ErrClosedPipe, err)
+	assert.EqualValues(t, 0, n)
+	// A plain value works too, e.g. for io.Copy.
+	var _ io.WriterTo = id
+}
+
+// errorWriter is an io.Writer that always fails with the given error.
+type errorWriter struct {
+	err error
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestEncodeBase64(t *testing.T) {
+	h := Sum(sequentialInput(BlockSize + 1))
+	var buf bytes.Buffer
+	require.NoError(t, EncodeBase64(&buf, h))
+	buf.WriteByte(',')
+	require.NoError(t, EncodeHex(&buf, h))
+	assert.Equal(t, SumBase64(sequentialInput(BlockSize+1))+","+ContentID(h).String(), buf.String())
+	assert.Error(t, EncodeBase64(&errorWriter{io.ErrShortWrite}, h))
+	assert.Error(t, EncodeHex(&errorWriter{io.ErrShortWrite}, h))
+}
+
+func TestFormatIdentifier(t *testing.T) {
+	assert.Equal(t, "VSO0:1E57CF2792A900D06C1CDFB3C453F35BC86F72788AA9724C96C929D1CC6B456A00", FormatIdentifier(Sum(nil)))
+}
+
+func TestParse(t *testing.T) {
+	for _, lim := range []int{0, 1, BlockSize + 1} {
+		sum := Sum(sequentialInput(lim))
+		id, err := Parse(FormatIdentifier(sum))
+		require.NoError(t, err)
+		assert.Equal(t, sum, id)
+	}
+	id, err := Parse("VSO0:1e57cf2792a900d06c1cdfb3c453f35bc86f72788aa9724c96c929d1cc6b456a00")
+	require.NoError(t, err)
+	assert.Equal(t, Sum(nil), id)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"1E57CF2792A900D06C1CDFB3C453F35BC86F72788AA9724C96C929D1CC6B456A00",
+		"vso0:1E57CF2792A900D06C1CDFB3C453F35BC86F72788AA9724C96C929D1CC6B456A00",
+		"SHA256:1E57CF2792A900D06C1CDFB3C453F35BC86F72788AA9724C96C929D1CC6B456A",
+		"VSO0:1E57CF2792A900D06C1CDFB3C453F35BC86F72788AA9724C96C929D1CC6B456A",
+		"VSO0:1E57CF2792A900D06C1CDFB3C453F35BC86F72788AA9724C96C929D1CC6B456A0000",
+		"VSO0:1E57CF2792A900D06C1CDFB3C453F35BC86F72788AA9724C96C929D1CC6B456AZZ",
+		"VSO0:1E57CF2792A900D06C1CDFB3C453F35BC86F72788AA9724C96C929D1CC6B456A01",
+	} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestEmptyHash(t *testing.T) {
+	assert.Equal(t, Sum(nil), EmptyHash)
+	assert.True(t, IsEmpty(Sum(nil)))
+	assert.True(t, IsEmpty(Sum([]byte{})))
+	assert.False(t, IsEmpty(Sum([]byte{0})))
+}
+
+func TestSHA256Part(t *testing.T) {
+	h := Sum(sequentialInput(BlockSize + 1))
+	part := SHA256Part(h)
+	assert.Equal(t, h[:sha256.Size], part[:])
+	assert.Equal(t, AlgorithmID, AlgorithmByte(h))
+	// It should be the same as the equivalent paged hash.
+	paged := NewPaged(PageSize, BlockSize, 2)
+	paged.Write(sequentialInput(BlockSize + 1))
+	assert.Equal(t, paged.Sum(nil), part[:])
+}
+
+func TestCheckAlgorithm(t *testing.T) {
+	h := Sum(nil)
+	assert.NoError(t, CheckAlgorithm(h))
+	h[Size-1] = 1
+	assert.Equal(t, byte(1), AlgorithmByte(h))
+	assert.EqualError(t, CheckAlgorithm(h), "vsohash: unknown algorithm byte 1")
+}
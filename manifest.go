@@ -0,0 +1,64 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// manifestMagic starts every manifest; the last byte is the format version.
+const manifestMagic = "vsom\x01"
+
+// ErrNotVSOHash is returned when asking for something that only makes sense for the standard VSO-Hash
+// of a hash with a different structure (see NewPagedHash).
+var ErrNotVSOHash = errors.New("vsohash: hash doesn't have the standard VSO-Hash structure")
+
+// WriteManifest writes a manifest of the hash's blocks to w, i.e. the hashes of each of them in order
+// (as for BlockHashes). It should be called once everything has been written; ReadManifest reads it back,
+// and CombineBlockHashes (or VerifyManifest) gets the identifier of the whole input from it.
+// The format is the magic string "vsom", a version byte (currently 1), the number of blocks as a big-endian
+// uint64, and then the 32-byte hash of each block.
+// It returns ErrNotVSOHash for hashes whose blocks aren't standard VSO-Hash ones, and the hash's error
+// if hashing any page failed (see PanicError).
+func (v *vsoHash) WriteManifest(w io.Writer) error {
+	if !v.isVSOHash() {
+		return ErrNotVSOHash
+	}
+	hashes := v.BlockHashes()
+	if v.err != nil {
+		return v.err
+	}
+	b := make([]byte, len(manifestMagic)+8, len(manifestMagic)+8+len(hashes)*sha256.Size)
+	copy(b, manifestMagic)
+	binary.BigEndian.PutUint64(b[len(manifestMagic):], uint64(len(hashes)))
+	for _, h := range hashes {
+		b = append(b, h[:]...)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// ReadManifest reads a manifest written by WriteManifest and returns the block hashes in it.
+func ReadManifest(r io.Reader) ([][sha256.Size]byte, error) {
+	var header [len(manifestMagic) + 8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("vsohash: failed to read manifest header: %w", err)
+	} else if string(header[:len(manifestMagic)-1]) != manifestMagic[:len(manifestMagic)-1] {
+		return nil, errors.New("vsohash: invalid manifest")
+	} else if header[len(manifestMagic)-1] != manifestMagic[len(manifestMagic)-1] {
+		return nil, fmt.Errorf("vsohash: unsupported manifest version %d", header[len(manifestMagic)-1])
+	}
+	n := binary.BigEndian.Uint64(header[len(manifestMagic):])
+	// The count isn't trusted for allocating up front, since a corrupt one could be enormous.
+	var hashes [][sha256.Size]byte
+	for i := uint64(0); i < n; i++ {
+		var h [sha256.Size]byte
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return nil, fmt.Errorf("vsohash: failed to read block %d of manifest: %w", i, err)
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, nil
+}
@@ -0,0 +1,73 @@
+package vsohash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 5, BlockSize, 3*BlockSize + PageSize + 1} {
+		in := sequentialInput(size)
+		h := New().(Hasher)
+		h.Write(in)
+		var buf bytes.Buffer
+		require.NoError(t, h.WriteManifest(&buf))
+		hashes, err := ReadManifest(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, h.BlockHashes(), hashes)
+		assert.Equal(t, Sum(in), CombineBlockHashes(hashes))
+		h.Close()
+	}
+}
+
+func TestManifestFormat(t *testing.T) {
+	h := New().(Hasher)
+	defer h.Close()
+	h.Write(sequentialInput(BlockSize + 1))
+	var buf bytes.Buffer
+	require.NoError(t, h.WriteManifest(&buf))
+	b := buf.Bytes()
+	assert.Equal(t, "vsom\x01\x00\x00\x00\x00\x00\x00\x00\x02", string(b[:13]))
+	assert.Equal(t, 13+2*sha256.Size, len(b))
+}
+
+func TestReadManifestInvalid(t *testing.T) {
+	h := New().(Hasher)
+	defer h.Close()
+	h.Write(sequentialInput(BlockSize + 1))
+	var buf bytes.Buffer
+	require.NoError(t, h.WriteManifest(&buf))
+	valid := buf.Bytes()
+
+	_, err := ReadManifest(bytes.NewReader(valid[:len(valid)-1]))
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+	_, err = ReadManifest(bytes.NewReader(valid[:3]))
+	assert.Error(t, err)
+	_, err = ReadManifest(bytes.NewReader(append([]byte("vsox"), valid[4:]...)))
+	assert.Error(t, err)
+	_, err = ReadManifest(bytes.NewReader(append([]byte("vsom\x02"), valid[5:]...)))
+	assert.EqualError(t, err, "vsohash: unsupported manifest version 2")
+	// A huge count shouldn't cause a huge allocation before finding there's nothing there.
+	_, err = ReadManifest(bytes.NewReader([]byte("vsom\x01\xff\xff\xff\xff\xff\xff\xff\xff")))
+	assert.Error(t, err)
+}
+
+func TestWriteManifestNotVSOHash(t *testing.T) {
+	h := NewPagedHash(sha256.New, 4096, 1024, 1).(Hasher)
+	assert.Equal(t, ErrNotVSOHash, h.WriteManifest(io.Discard))
+}
+
+func TestWriteManifestAfterPanic(t *testing.T) {
+	h := newFailedHash(t)
+	var buf bytes.Buffer
+	err := h.WriteManifest(&buf)
+	var perr *PanicError
+	assert.True(t, errors.As(err, &perr))
+	assert.Zero(t, buf.Len())
+}
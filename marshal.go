@@ -0,0 +1,215 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+const marshalMagic = "vso\x01"
+
+var errInvalidState = errors.New("vsohash: invalid hash state size")
+
+var errInvalidIdentifier = errors.New("vsohash: invalid hash state identifier")
+
+// MarshalBinary implements encoding.BinaryMarshaler. It captures the current state of the hash so that hashing
+// can be resumed later (e.g. in another process) via UnmarshalBinary; as for the standard library's hashes,
+// the format is only intended to be read by this package.
+// Any pages that are still being hashed are waited for first. The options the hash was created with aren't
+// included, so the hash it's restored into should be created with the same ones.
+func (v *vsoHash) MarshalBinary() ([]byte, error) {
+	v.resolveBlocks()
+	pages := v.peekPages()
+	if v.err != nil {
+		return nil, v.err
+	} else if err := v.opts.ctxErr(); err != nil {
+		return nil, err
+	}
+	return v.marshal(v.written, v.buffer.Bytes(), v.block, pages), nil
+}
+
+// Checkpoint is like MarshalBinary, but only captures the state as of the last block boundary, discarding
+// anything written since then. That's much cheaper to restore (and notably doesn't need any of the current
+// block's data), so is useful to periodically record progress through a very large input.
+//
+// The hash restored from it (via ResumeFrom, or UnmarshalBinary) must then be given the input from the
+// offset of that boundary, not from where this hash had got to; CheckpointOffset returns it.
+func (v *vsoHash) Checkpoint() ([]byte, error) {
+	v.resolveBlocks()
+	if v.err != nil {
+		return nil, v.err
+	} else if err := v.opts.ctxErr(); err != nil {
+		return nil, err
+	}
+	return v.marshal(int64(v.blocks)*int64(v.pageSize*v.pagesPerBlock), nil, nil, nil), nil
+}
+
+// ResumeFrom returns a new hash restored from the given checkpoint (or from any state returned by MarshalBinary),
+// with the given parallelism and options. See Checkpoint for more details.
+func ResumeFrom(data []byte, parallelism int, opts ...Option) (hash.Hash, error) {
+	h := NewParallel(parallelism, opts...).(*vsoHash)
+	if err := h.UnmarshalBinary(data); err != nil {
+		h.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// CheckpointOffset returns the offset in the input that the given checkpoint was taken at, which is where
+// input should be resumed from.
+func CheckpointOffset(data []byte) (int64, error) {
+	if len(data) < len(marshalMagic) || string(data[:len(marshalMagic)]) != marshalMagic {
+		return 0, errInvalidIdentifier
+	}
+	// The offset is the fifth field, after the hash's structure.
+	data = data[len(marshalMagic):]
+	if len(data) < 4*8 {
+		return 0, errInvalidState
+	}
+	return int64(binary.BigEndian.Uint64(data[3*8:])), nil
+}
+
+// marshal returns the given state of the hash, in the format that UnmarshalBinary reads.
+func (v *vsoHash) marshal(written int64, buffer, block []byte, pages []digest) []byte {
+	size := v.inner.Size()
+	b := make([]byte, 0, len(marshalMagic)+8*9+v.blobID.Len()+len(buffer)+len(block)+len(pages)*size+len(v.blockHashes)*sha256.Size)
+	b = append(b, marshalMagic...)
+	b = appendUint64(b, uint64(v.pageSize))
+	b = appendUint64(b, uint64(v.pagesPerBlock))
+	b = appendUint64(b, uint64(size))
+	b = appendUint64(b, uint64(written))
+	b = appendUint64(b, uint64(v.blocks))
+	b = appendBytes(b, v.blobID.Bytes())
+	b = appendBytes(b, buffer)
+	b = appendBytes(b, block)
+	b = appendUint64(b, uint64(len(pages)))
+	for _, page := range pages {
+		b = append(b, page[:size]...)
+	}
+	b = appendUint64(b, uint64(len(v.blockHashes)))
+	for _, h := range v.blockHashes {
+		b = append(b, h[:]...)
+	}
+	return b
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It restores a state previously returned by MarshalBinary,
+// replacing the hash's current state. The state must have come from a hash with the same structure (i.e. a VSO-Hash
+// can only be restored from another VSO-Hash), and one that was partway through a block with WithBlockCache can only
+// be restored into a hash that also has a block cache.
+func (v *vsoHash) UnmarshalBinary(b []byte) error {
+	return v.unmarshal(b, v.opts.cache != nil)
+}
+
+// unmarshal is the implementation of UnmarshalBinary. If cached is false, it refuses states that have part of
+// a block buffered for the block cache.
+func (v *vsoHash) unmarshal(b []byte, cached bool) error {
+	if len(b) < len(marshalMagic) || string(b[:len(marshalMagic)]) != marshalMagic {
+		return errInvalidIdentifier
+	}
+	data := b
+	b = b[len(marshalMagic):]
+	var pageSize, pagesPerBlock, size, written, blocks, n, m uint64
+	var blobID, buffer, block, pages []byte
+	var ok bool
+	if b, pageSize, ok = consumeUint64(b); !ok {
+		return errInvalidState
+	} else if b, pagesPerBlock, ok = consumeUint64(b); !ok {
+		return errInvalidState
+	} else if b, size, ok = consumeUint64(b); !ok {
+		return errInvalidState
+	} else if pageSize != uint64(v.pageSize) || pagesPerBlock != uint64(v.pagesPerBlock) || size != uint64(v.inner.Size()) {
+		return errors.New("vsohash: hash state has a different structure to this hash")
+	} else if b, written, ok = consumeUint64(b); !ok {
+		return errInvalidState
+	} else if b, blocks, ok = consumeUint64(b); !ok {
+		return errInvalidState
+	} else if b, blobID, ok = consumeBytes(b); !ok {
+		return errInvalidState
+	} else if b, buffer, ok = consumeBytes(b); !ok || len(buffer) >= v.pageSize {
+		return errInvalidState
+	} else if b, block, ok = consumeBytes(b); !ok || len(block) >= v.pageSize*v.pagesPerBlock {
+		return errInvalidState
+	} else if b, n, ok = consumeUint64(b); !ok || n >= uint64(v.pagesPerBlock) || uint64(len(b)) < n*size {
+		return errInvalidState
+	}
+	pages, b = b[:n*size], b[n*size:]
+	if b, m, ok = consumeUint64(b); !ok || len(b)%sha256.Size != 0 || uint64(len(b)/sha256.Size) != m {
+		return errInvalidState
+	} else if len(block) > 0 && !cached {
+		return errors.New("vsohash: hash state is partway through a cached block, but this hash has no block cache")
+	} else if !v.consistentState(written, blocks, m, len(blobID), len(buffer)+len(block)+int(n)*v.pageSize) {
+		return errors.New("vsohash: hash state is inconsistent")
+	}
+	v.Reset()
+	for ; len(pages) > 0; v.current.n++ {
+		pages = pages[copy(v.current.pages[v.current.n][:size], pages):]
+	}
+	for len(b) > 0 {
+		var h [sha256.Size]byte
+		b = b[copy(h[:], b):]
+		v.blockHashes = append(v.blockHashes, h)
+	}
+	v.written = int64(written)
+	v.blocks = int(blocks)
+	v.blobID.Write(blobID)
+	v.buffer.Write(buffer)
+	v.block = append(v.block, block...)
+	if v.shadow != nil {
+		v.shadow.unmarshal(data, true)
+		// The self-check hash doesn't have a block cache, so if this one was holding onto part of a block
+		// for it, that has to be written to it properly.
+		block := v.shadow.block
+		v.shadow.block = nil
+		v.shadow.written -= int64(len(block))
+		v.shadow.write(block)
+	}
+	return nil
+}
+
+// consistentState returns true if the given parts of a marshalled state agree with one another, where pending is
+// the number of bytes written since the last block boundary.
+func (v *vsoHash) consistentState(written, blocks, blockHashes uint64, blobID, pending int) bool {
+	size := v.inner.Size()
+	if size == sha256.Size && blockHashes != blocks || size != sha256.Size && blockHashes != 0 {
+		return false
+	} else if blocks > written/uint64(v.pageSize*v.pagesPerBlock) || written != blocks*uint64(v.pageSize*v.pagesPerBlock)+uint64(pending) {
+		// The first check just makes sure the second can't overflow.
+		return false
+	}
+	switch blocks {
+	case 0:
+		return blobID == 0
+	case 1:
+		return blobID == len(v.opts.blobIDSeed())+size
+	default:
+		return blobID == 2*size
+	}
+}
+
+func appendUint64(b []byte, x uint64) []byte {
+	var a [8]byte
+	binary.BigEndian.PutUint64(a[:], x)
+	return append(b, a[:]...)
+}
+
+func appendBytes(b, x []byte) []byte {
+	b = appendUint64(b, uint64(len(x)))
+	return append(b, x...)
+}
+
+func consumeUint64(b []byte) ([]byte, uint64, bool) {
+	if len(b) < 8 {
+		return b, 0, false
+	}
+	return b[8:], binary.BigEndian.Uint64(b), true
+}
+
+func consumeBytes(b []byte) ([]byte, []byte, bool) {
+	b, n, ok := consumeUint64(b)
+	if !ok || uint64(len(b)) < n {
+		return b, nil, false
+	}
+	return b[n:], b[:n], true
+}
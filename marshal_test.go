@@ -0,0 +1,146 @@
+package vsohash
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for lim, hash := range blobIDVectors {
+		for _, cached := range []bool{false, true} {
+			in := sequentialInput(lim)
+			for _, split := range []int{0, lim / 3, lim / 2, lim} {
+				t.Run(fmt.Sprintf("Size%dSplit%dCached%v", lim, split, cached), func(t *testing.T) {
+					var opts []Option
+					if cached {
+						opts = append(opts, WithBlockCache(newMapCache()))
+					}
+					h := New(opts...).(Hasher)
+					defer h.Close()
+					h.Write(in[:split])
+					state, err := h.MarshalBinary()
+					require.NoError(t, err)
+					// Restore into a fresh hash and carry on from there.
+					h2 := New(opts...).(Hasher)
+					defer h2.Close()
+					require.NoError(t, h2.UnmarshalBinary(state))
+					h2.Write(in[split:])
+					sum := sumArray(h2)
+					assert.Equal(t, hash, hex.EncodeToString(sum[:]))
+					assert.Equal(t, blockHashesOf(in), h2.BlockHashes())
+				})
+			}
+		}
+	}
+}
+
+func TestMarshalPagedHash(t *testing.T) {
+	in := sequentialInput(2*BlockSize + 100)
+	h := NewPagedHash(sha512.New, BlockSize, PageSize, 2).(Hasher)
+	h.Write(in[:BlockSize+PageSize+1])
+	state, err := h.MarshalBinary()
+	require.NoError(t, err)
+	h2 := NewPagedHash(sha512.New, BlockSize, PageSize, 2).(Hasher)
+	require.NoError(t, h2.UnmarshalBinary(state))
+	h2.Write(in[BlockSize+PageSize+1:])
+	assert.Equal(t, pagedSum(sha512.New(), in, BlockSize, PageSize), h2.Sum(nil))
+	// It can't be restored into a hash with a different structure.
+	assert.Error(t, New().(Hasher).UnmarshalBinary(state))
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	h := New().(Hasher)
+	h.Write(sequentialInput(BlockSize + PageSize + 1))
+	state, err := h.MarshalBinary()
+	require.NoError(t, err)
+	h2 := New().(Hasher)
+	assert.Error(t, h2.UnmarshalBinary(nil))
+	assert.Error(t, h2.UnmarshalBinary([]byte("sha\x03")))
+	for i := len(marshalMagic); i < len(state); i += 7 {
+		assert.Error(t, h2.UnmarshalBinary(state[:i]))
+	}
+	assert.Error(t, h2.UnmarshalBinary(append(state, 0)))
+	// None of the failures should have changed anything.
+	assert.Equal(t, Sum(nil), sumArray(h2))
+}
+
+func TestUnmarshalCachedIntoUncached(t *testing.T) {
+	in := sequentialInput(BlockSize + PageSize + 1)
+	h := New(WithBlockCache(newMapCache())).(Hasher)
+	h.Write(in)
+	state, err := h.MarshalBinary()
+	require.NoError(t, err)
+	assert.Error(t, New().(Hasher).UnmarshalBinary(state))
+	h2 := New(WithBlockCache(newMapCache())).(Hasher)
+	require.NoError(t, h2.UnmarshalBinary(state))
+	assert.Equal(t, Sum(in), sumArray(h2))
+}
+
+func TestUnmarshalInconsistent(t *testing.T) {
+	for name, corrupt := range map[string]func(h *vsoHash){
+		"BlockCount":  func(h *vsoHash) { h.blocks++ },
+		"BlobID":      func(h *vsoHash) { h.blobID.WriteByte(0) },
+		"BlockHashes": func(h *vsoHash) { h.blockHashes = h.blockHashes[:1] },
+		"Written":     func(h *vsoHash) { h.written-- },
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := New().(*vsoHash)
+			defer h.Close()
+			h.Write(sequentialInput(2*BlockSize + PageSize + 1))
+			h.resolveBlocks()
+			corrupt(h)
+			state, err := h.MarshalBinary()
+			require.NoError(t, err)
+			assert.Error(t, New().(Hasher).UnmarshalBinary(state))
+		})
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	for lim, hash := range blobIDVectors {
+		in := sequentialInput(lim)
+		for _, split := range []int{0, lim / 3, lim} {
+			t.Run(fmt.Sprintf("Size%dSplit%d", lim, split), func(t *testing.T) {
+				h := New().(Hasher)
+				defer h.Close()
+				h.Write(in[:split])
+				checkpoint, err := h.Checkpoint()
+				require.NoError(t, err)
+				offset, err := CheckpointOffset(checkpoint)
+				require.NoError(t, err)
+				assert.Equal(t, int64(split/BlockSize*BlockSize), offset)
+				h2, err := ResumeFrom(checkpoint, 2)
+				require.NoError(t, err)
+				defer h2.(Hasher).Close()
+				h2.Write(in[offset:])
+				sum := sumArray(h2)
+				assert.Equal(t, hash, hex.EncodeToString(sum[:]))
+				assert.Equal(t, blockHashesOf(in), h2.(Hasher).BlockHashes())
+			})
+		}
+	}
+}
+
+func TestResumeFromInvalid(t *testing.T) {
+	_, err := ResumeFrom([]byte("nope"), 2)
+	assert.Error(t, err)
+	_, err = CheckpointOffset([]byte("nope"))
+	assert.Error(t, err)
+	_, err = CheckpointOffset([]byte(marshalMagic))
+	assert.Error(t, err)
+}
+
+func TestCheckpointAfterPanic(t *testing.T) {
+	h := newFailedHash(t)
+	_, err := h.Checkpoint()
+	var perr *PanicError
+	assert.True(t, errors.As(err, &perr))
+	// The blocks after the failed one mustn't have been chained on.
+	assert.Equal(t, 1, h.blocks)
+}
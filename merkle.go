@@ -0,0 +1,133 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// ErrNoMerkleTree is returned when requesting Merkle tree information from a hash that wasn't created WithMerkleTree.
+var ErrNoMerkleTree = errors.New("vsohash: hash was not created with a Merkle tree")
+
+// WithMerkleTree returns an option that enables MerkleRoot and BlockProof, which give a Merkle tree over the
+// block hashes. The VSO-Hash blob id is a chain, so a single block can't be verified without hashing everything
+// before it; the tree allows verifying individual blocks against its root via BlockProof and VerifyBlockProof.
+//
+// Only the block hashes themselves are calculated by the workers, as they are anyway. The tree isn't built
+// as the input is written; MerkleRoot and BlockProof calculate what they need from the block hashes each time
+// they're called, which takes time proportional to the number of blocks (but is tiny compared to hashing them).
+// Without this option there's no cost at all.
+//
+// The tree is constructed as in RFC 6962 (section 2.1), with the block hashes as its leaves; i.e. leaves
+// are hashed with a 0x00 prefix and interior nodes with a 0x01 prefix. It is entirely separate from the
+// VSO-Hash identifier, which is unaffected by this.
+func WithMerkleTree() Option {
+	return func(o *options) {
+		o.merkle = true
+	}
+}
+
+// MerkleRoot returns the root of the Merkle tree over all the blocks hashed so far
+// (including any incomplete final block, as for BlockHashes).
+// If hashing failed or the hash's context was cancelled, it returns the same error as SumErr would.
+func (v *vsoHash) MerkleRoot() ([sha256.Size]byte, error) {
+	if !v.opts.merkle {
+		return [sha256.Size]byte{}, ErrNoMerkleTree
+	}
+	hashes, err := v.blockHashesErr()
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return merkleRoot(hashes), nil
+}
+
+// BlockProof returns the inclusion proof for the block at the given index, i.e. the list of sibling hashes
+// from that block's leaf up to the root. As with MerkleRoot, any incomplete final block is included.
+func (v *vsoHash) BlockProof(index int) ([][sha256.Size]byte, error) {
+	if !v.opts.merkle {
+		return nil, ErrNoMerkleTree
+	}
+	hashes, err := v.blockHashesErr()
+	if err != nil {
+		return nil, err
+	} else if index < 0 || index >= len(hashes) {
+		return nil, fmt.Errorf("vsohash: block index %d out of range (have %d blocks)", index, len(hashes))
+	}
+	return merklePath(index, hashes), nil
+}
+
+// VerifyBlockProof returns true if the given proof shows that the block at the given index, with the given hash,
+// is part of the Merkle tree with the given root over count blocks.
+func VerifyBlockProof(root [sha256.Size]byte, index, count int, blockHash [sha256.Size]byte, proof [][sha256.Size]byte) bool {
+	if index < 0 || index >= count {
+		return false
+	}
+	// This is the verification algorithm from RFC 9162 section 2.1.3.2.
+	fn := index
+	sn := count - 1
+	r := merkleLeaf(blockHash)
+	for _, p := range proof {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNode(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNode(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && r == root
+}
+
+// merkleRoot returns the root of the Merkle tree over the given leaves.
+func merkleRoot(leaves [][sha256.Size]byte) [sha256.Size]byte {
+	switch len(leaves) {
+	case 0:
+		return sha256.Sum256(nil)
+	case 1:
+		return merkleLeaf(leaves[0])
+	}
+	k := merkleSplit(len(leaves))
+	return merkleNode(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
+
+// merklePath returns the audit path for the given leaf.
+func merklePath(index int, leaves [][sha256.Size]byte) [][sha256.Size]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := merkleSplit(len(leaves))
+	if index < k {
+		return append(merklePath(index, leaves[:k]), merkleRoot(leaves[k:]))
+	}
+	return append(merklePath(index-k, leaves[k:]), merkleRoot(leaves[:k]))
+}
+
+// merkleSplit returns the largest power of two smaller than n (which must be at least 2).
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+func merkleLeaf(h [sha256.Size]byte) [sha256.Size]byte {
+	var b [1 + sha256.Size]byte
+	copy(b[1:], h[:])
+	return sha256.Sum256(b[:])
+}
+
+func merkleNode(left, right [sha256.Size]byte) [sha256.Size]byte {
+	var b [1 + 2*sha256.Size]byte
+	b[0] = 1
+	copy(b[1:], left[:])
+	copy(b[1+sha256.Size:], right[:])
+	return sha256.Sum256(b[:])
+}
@@ -0,0 +1,93 @@
+package vsohash
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerkleProofs(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		t.Run(fmt.Sprintf("Blocks%d", n), func(t *testing.T) {
+			leaves := make([][sha256.Size]byte, n)
+			for i := range leaves {
+				leaves[i] = sha256.Sum256([]byte{byte(i)})
+			}
+			root := merkleRoot(leaves)
+			for i, leaf := range leaves {
+				proof := merklePath(i, leaves)
+				assert.True(t, VerifyBlockProof(root, i, n, leaf, proof), "block %d", i)
+				// The proof shouldn't work for the wrong block or the wrong position.
+				assert.False(t, VerifyBlockProof(root, i, n, sha256.Sum256(nil), proof))
+				if n > 1 {
+					assert.False(t, VerifyBlockProof(root, (i+1)%n, n, leaf, proof))
+				}
+			}
+		})
+	}
+}
+
+func TestMerkleRootIsStable(t *testing.T) {
+	// Check against a manual construction for three leaves, which is the simplest unbalanced tree.
+	a, b, c := sha256.Sum256([]byte("a")), sha256.Sum256([]byte("b")), sha256.Sum256([]byte("c"))
+	expected := merkleNode(merkleNode(merkleLeaf(a), merkleLeaf(b)), merkleLeaf(c))
+	assert.Equal(t, expected, merkleRoot([][sha256.Size]byte{a, b, c}))
+}
+
+func TestHashWithMerkleTree(t *testing.T) {
+	in := sequentialInput(3*BlockSize + 100)
+	h := New(WithMerkleTree()).(Hasher)
+	h.Write(in)
+	sum, err := h.SumErr()
+	require.NoError(t, err)
+	assert.Equal(t, Sum(in), sum) // The normal identifier must be unaffected
+	root, err := h.MerkleRoot()
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		end := (i + 1) * BlockSize
+		if end > len(in) {
+			end = len(in)
+		}
+		proof, err := h.BlockProof(i)
+		require.NoError(t, err)
+		assert.True(t, VerifyBlockProof(root, i, 4, BlockHash(in[i*BlockSize:end]), proof))
+	}
+	_, err = h.BlockProof(4)
+	assert.Error(t, err)
+}
+
+func TestMerkleTreeIsOptIn(t *testing.T) {
+	h := New().(Hasher)
+	h.Write([]byte("hello"))
+	h.Sum(nil)
+	_, err := h.MerkleRoot()
+	assert.Equal(t, ErrNoMerkleTree, err)
+	_, err = h.BlockProof(0)
+	assert.Equal(t, ErrNoMerkleTree, err)
+}
+
+func TestMerkleTreeAfterPanic(t *testing.T) {
+	h := newFailedHash(t)
+	h.opts.merkle = true
+	_, err := h.MerkleRoot()
+	var perr *PanicError
+	assert.ErrorAs(t, err, &perr)
+	_, err = h.BlockProof(0)
+	assert.ErrorAs(t, err, &perr)
+}
+
+func TestMerkleTreeCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := NewWithContext(ctx, 4, WithMerkleTree()).(Hasher)
+	defer h.Close()
+	h.Write(sequentialInput(2 * BlockSize))
+	cancel()
+	_, err := h.MerkleRoot()
+	assert.Equal(t, context.Canceled, err)
+	_, err = h.BlockProof(0)
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,22 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package vsohash
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmap maps the first size bytes of the given file into memory, read-only.
+func mmap(f *os.File, size int64) ([]byte, error) {
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("file of %d bytes is too large to map", size)
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap unmaps memory previously mapped by mmap.
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
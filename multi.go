@@ -0,0 +1,94 @@
+package vsohash
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"hash"
+)
+
+// Digests is a set of additional digests for a MultiHash to calculate.
+type Digests int
+
+const (
+	// SHA256Digest is a plain SHA256 of the whole input.
+	SHA256Digest Digests = 1 << iota
+	// MD5Digest is an MD5 of the whole input (as e.g. Azure Blob Storage wants for Content-MD5).
+	MD5Digest
+)
+
+// A MultiHash calculates the VSO-Hash of its input along with some other digests of it, so they can all
+// be had from one pass over the data.
+// The other digests are of the whole input, so can't share any of the work done for the VSO-Hash (whose
+// SHA256s are of each page) and are calculated in Write itself.
+type MultiHash struct {
+	vso    Hasher
+	sha256 hash.Hash
+	md5    hash.Hash
+}
+
+// NewMultiHash returns a new MultiHash that calculates the given digests as well as the VSO-Hash.
+// The options apply to the VSO-Hash. As for New, it should be closed once it's no longer needed.
+func NewMultiHash(digests Digests, opts ...Option) *MultiHash {
+	m := &MultiHash{vso: New(opts...).(Hasher)}
+	if digests&SHA256Digest != 0 {
+		m.sha256 = newSHA256()
+	}
+	if digests&MD5Digest != 0 {
+		m.md5 = md5.New()
+	}
+	return m
+}
+
+// Write writes more data to all the hashes.
+func (m *MultiHash) Write(p []byte) (int, error) {
+	n, err := m.vso.Write(p)
+	// The others can't fail, but should only see what the VSO-Hash has.
+	if m.sha256 != nil {
+		m.sha256.Write(p[:n])
+	}
+	if m.md5 != nil {
+		m.md5.Write(p[:n])
+	}
+	return n, err
+}
+
+// VSO returns the VSO-Hash of everything written so far, or an error if it can't be calculated (see SumErr).
+func (m *MultiHash) VSO() ([Size]byte, error) {
+	return m.vso.SumErr()
+}
+
+// SHA256 returns the SHA256 of everything written so far. It panics if the hash wasn't created with SHA256Digest.
+func (m *MultiHash) SHA256() [sha256.Size]byte {
+	if m.sha256 == nil {
+		panic("MultiHash wasn't created with SHA256Digest")
+	}
+	var ret [sha256.Size]byte
+	m.sha256.Sum(ret[:0])
+	return ret
+}
+
+// MD5 returns the MD5 of everything written so far. It panics if the hash wasn't created with MD5Digest.
+func (m *MultiHash) MD5() [md5.Size]byte {
+	if m.md5 == nil {
+		panic("MultiHash wasn't created with MD5Digest")
+	}
+	var ret [md5.Size]byte
+	m.md5.Sum(ret[:0])
+	return ret
+}
+
+// Reset resets all the hashes to their initial state.
+func (m *MultiHash) Reset() {
+	m.vso.Reset()
+	if m.sha256 != nil {
+		m.sha256.Reset()
+	}
+	if m.md5 != nil {
+		m.md5.Reset()
+	}
+}
+
+// Close releases the VSO-Hash's background goroutines (see Close on it); the hash can't be written to afterwards.
+func (m *MultiHash) Close() error {
+	return m.vso.Close()
+}
@@ -0,0 +1,41 @@
+package vsohash
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiHash(t *testing.T) {
+	in := sequentialInput(BlockSize + PageSize + 17)
+	m := NewMultiHash(SHA256Digest | MD5Digest)
+	defer m.Close()
+	m.Write(in[:PageSize+3])
+	m.Write(in[PageSize+3:])
+	sum, err := m.VSO()
+	require.NoError(t, err)
+	assert.Equal(t, Sum(in), sum)
+	assert.Equal(t, sha256.Sum256(in), m.SHA256())
+	assert.Equal(t, md5.Sum(in), m.MD5())
+	m.Reset()
+	m.Write(in[:5])
+	assert.Equal(t, md5.Sum(in[:5]), m.MD5())
+}
+
+func TestMultiHashUnselectedDigest(t *testing.T) {
+	m := NewMultiHash(MD5Digest)
+	defer m.Close()
+	assert.Panics(t, func() { m.SHA256() })
+	assert.Equal(t, md5.Sum(nil), m.MD5())
+}
+
+func TestMultiHashAfterClose(t *testing.T) {
+	m := NewMultiHash(SHA256Digest)
+	m.Close()
+	_, err := m.Write([]byte("hello"))
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, sha256.Sum256(nil), m.SHA256())
+}
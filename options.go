@@ -0,0 +1,283 @@
+package vsohash
+
+import (
+	"context"
+	"crypto/sha256"
+)
+
+// An Option configures optional behaviour of a hash when it's created.
+type Option func(*options)
+
+// options is the set of configuration that can be applied to a hash.
+type options struct {
+	cache       BlockCache
+	retry       RetryPolicy
+	rejectEmpty bool
+	sem         chan struct{}
+	merkle      bool
+	affinity    bool
+	mmap        bool
+	alignment   bool
+	ctx         context.Context
+	maxInFlight int
+	observer    func(index int, hash [sha256.Size]byte)
+	parallelism int
+	buffers     BufferPool
+	seed        string
+	customSeed  bool
+	progress    func(bytesHashed int64)
+	logger      func(msg string, args ...any)
+	noFinalizer bool
+	selfCheck   bool
+	// The size given to WithExpectedSize, if it was
+	expectedSize    int64
+	hasExpectedSize bool
+}
+
+// withContext returns an option that ties the hash to the given context (see NewWithContext).
+func withContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// done returns a channel that's closed when the hash's context is cancelled, or nil if it doesn't have one.
+func (o *options) done() <-chan struct{} {
+	if o.ctx == nil {
+		return nil
+	}
+	return o.ctx.Done()
+}
+
+// ctxErr returns the error from the hash's context, if it has one.
+func (o *options) ctxErr() error {
+	if o.ctx == nil {
+		return nil
+	}
+	return o.ctx.Err()
+}
+
+// blobIDSeed returns the seed that the blob id starts from.
+func (o *options) blobIDSeed() string {
+	if o.customSeed {
+		return o.seed
+	}
+	return seed
+}
+
+// reportsBlocks returns true if these options want to hear about each block as soon as it's finished.
+func (o *options) reportsBlocks() bool {
+	return o.observer != nil || o.progress != nil
+}
+
+// checkSize returns an error if an input of the given size isn't permitted by these options.
+func (o *options) checkSize(size int64) error {
+	if o.rejectEmpty && size == 0 {
+		return ErrEmptyInput
+	} else if o.alignment && size%BlockSize != 0 {
+		return &BlockAlignmentError{Size: size}
+	}
+	return nil
+}
+
+// WithBlockCache returns an option that uses the given cache to avoid rehashing blocks
+// that have been seen before. See BlockCache for more details.
+// It can only be used with the standard VSO-Hash page & block sizes; the constructor panics otherwise.
+func WithBlockCache(cache BlockCache) Option {
+	return func(o *options) {
+		o.cache = cache
+	}
+}
+
+// WithRejectEmpty returns an option that controls whether empty input is rejected. If true, finalising
+// a hash with no content fails with ErrEmptyInput instead of returning the standard empty identifier.
+// This is useful for content stores that don't want to accept empty blobs. By default empty input is permitted.
+func WithRejectEmpty(reject bool) Option {
+	return func(o *options) {
+		o.rejectEmpty = reject
+	}
+}
+
+// WithAffinity returns an option that controls how pages are assigned to workers. By default all workers share
+// a single queue; with affinity each worker has its own and page i always goes to worker i % parallelism.
+// This is experimental; it may help cache locality on some machines but it also means that a slow worker
+// holds up the others.
+func WithAffinity(affinity bool) Option {
+	return func(o *options) {
+		o.affinity = affinity
+	}
+}
+
+// WithMmap returns an option that controls whether SumFile memory-maps files rather than reading them.
+// This avoids copying the file contents, which can help for very large files. It's only used for regular
+// files that are at least one block long, and falls back to reading the file if mapping fails or isn't
+// supported on this platform.
+func WithMmap(mmap bool) Option {
+	return func(o *options) {
+		o.mmap = mmap
+	}
+}
+
+// WithRequireBlockAlignment returns an option that controls whether the input must be a whole number of blocks.
+// If true, finalising a hash whose input isn't a multiple of BlockSize fails with a *BlockAlignmentError.
+// This is useful for stores that only deal in fixed-size blocks. An empty input is considered aligned
+// (use WithRejectEmpty as well to forbid that).
+func WithRequireBlockAlignment(require bool) Option {
+	return func(o *options) {
+		o.alignment = require
+	}
+}
+
+// WithMaxInFlightPages returns an option that limits the number of pages that can be waiting to be hashed at once;
+// Write blocks until a worker has finished with one before dispatching any more. This makes memory usage
+// predictable when the caller can produce data much faster than it can be hashed (something like parallelism*2
+// is usually enough to keep all the workers busy).
+// Without it, up to four blocks' worth of pages can be outstanding. n must be strictly positive.
+func WithMaxInFlightPages(n int) Option {
+	if n <= 0 {
+		panic("Max in-flight pages must be strictly positive")
+	}
+	return func(o *options) {
+		o.maxInFlight = n
+	}
+}
+
+// WithBlockObserver returns an option that calls the given function with the index and hash of each block
+// as soon as it's been hashed, in order. This is useful to process blocks progressively (e.g. to upload them)
+// rather than waiting for the whole input.
+// Only whole blocks are reported; a shorter final block can't be known to be final until the input ends,
+// so it's never passed to the observer (use BlockHashes once everything's written to get it).
+// The function is called synchronously from Write, so it holds up hashing while it runs; anything slow
+// should be handed off elsewhere.
+// It has no effect on SumReaderAt (or SumFile for regular files), which hash blocks out of order.
+func WithBlockObserver(observer func(index int, hash [sha256.Size]byte)) Option {
+	return func(o *options) {
+		o.observer = observer
+	}
+}
+
+// WithProgress returns an option that calls the given function with the total number of bytes hashed so far
+// each time a block is finished, and once more with the total when the hash is finalised (to account for the
+// last partial block). The totals passed to it only ever increase (until the hash is Reset).
+// As for WithBlockObserver it's called synchronously, so should return quickly.
+func WithProgress(progress func(bytesHashed int64)) Option {
+	return func(o *options) {
+		o.progress = progress
+	}
+}
+
+// WithLogger returns an option that logs each page and block as it's dispatched or finished, and each update
+// to the blob id, to the given function. That's useful to see where the boundaries fell when debugging a
+// mismatch against another implementation; it's far too verbose for anything else.
+// The args are alternating keys and values, as for slog. When no logger is given none of this costs anything.
+func WithLogger(logger func(msg string, args ...any)) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithoutFinalizer returns an option that stops the hash from setting a finalizer to release its workers
+// when it's garbage collected. That saves the GC some work for a server that creates a lot of them, but the
+// caller must then always Close it, otherwise its workers are never released.
+// Hashes from a Pool never have a finalizer anyway, since they don't have workers of their own; it mustn't be
+// given to a HasherPool, which relies on finalizers for hashes that it drops.
+func WithoutFinalizer() Option {
+	return func(o *options) {
+		o.noFinalizer = true
+	}
+}
+
+// WithSelfCheck returns an option that checks the hash's results are correct: everything written to it is
+// also written to a second hash that does it all sequentially, and finalising the hash panics if their results
+// differ. That's a differential test of the parallel pipeline for unusual write patterns that fixed test vectors
+// might miss, but it more than doubles the cost of hashing, so is only intended for debugging and tests.
+func WithSelfCheck() Option {
+	return func(o *options) {
+		o.selfCheck = true
+	}
+}
+
+// WithExpectedSize returns an option that tells the hash how much input to expect. It uses that to size its
+// buffers up front, and won't start more workers than there would be pages for (as for NewAuto; although if
+// WithParallelism is also given, that can still lower it further).
+// The size is only a hint; the result is still correct if more or less than it is written, and the space
+// reserved for block hashes is capped so a huge hint can't allocate a huge amount. (The other buffers have
+// a fixed size and are always allocated in full up front, with or without this.)
+// n must not be negative.
+func WithExpectedSize(n int64) Option {
+	if n < 0 {
+		panic("Expected size must not be negative")
+	}
+	return func(o *options) {
+		o.expectedSize = n
+		o.hasExpectedSize = true
+	}
+}
+
+// WithParallelism returns an option that sets the number of calculations the hash performs in parallel.
+// This takes precedence over the parallelism given to constructors like NewParallel, so New(WithParallelism(n))
+// is the same as NewParallel(n). It has no effect on hashes that don't have their own workers (e.g. NewFromPool
+// or NewSequential). SumFile also uses it in place of GOMAXPROCS. n must be strictly positive.
+func WithParallelism(n int) Option {
+	if n <= 0 {
+		panic("Parallelism must be strictly positive")
+	}
+	return func(o *options) {
+		o.parallelism = n
+	}
+}
+
+// A BufferPool supplies the page-sized buffers that a hash copies input into when it can't hash it in place
+// (for example pages that straddle calls to Write, or everything read by ReadFrom). Buffers are returned to it
+// once they've been hashed, possibly from another goroutine, so it must be safe for concurrent use.
+type BufferPool interface {
+	Get() *[PageSize]byte
+	Put(*[PageSize]byte)
+}
+
+// WithBufferPool returns an option that uses the given pool for the hash's page buffers. By default all hashes
+// share a pool backed by a sync.Pool; this allows e.g. a fixed set of preallocated buffers to be used instead.
+// It has no effect on hashes with a non-standard page size, which allocate their own buffers.
+func WithBufferPool(pool BufferPool) Option {
+	if pool == nil {
+		panic("Buffer pool must not be nil")
+	}
+	return func(o *options) {
+		o.buffers = pool
+	}
+}
+
+// WithSeed returns an option that uses the given seed for the blob id instead of the standard one. This gives
+// identifiers in a separate domain, so the same content has a different one for each seed.
+// This is of course completely incompatible with VSO-Hash (and BuildXL, Azure etc), so it can't be used with
+// a standard VSO-Hash (the constructors for one panic if given it); it's only for paged hashes (see NewPaged).
+func WithSeed(s string) Option {
+	return func(o *options) {
+		o.seed = s
+		o.customSeed = true
+	}
+}
+
+// A RetryPolicy decides whether to retry a failed read. It's called with the number of consecutive failed
+// attempts (starting from 1, and reset whenever a read makes some progress) and the error the last one
+// failed with, and returns true if the read should be tried again. It is free to sleep before returning if it wants to back off.
+//
+// It may be called concurrently from multiple goroutines.
+type RetryPolicy func(attempt int, err error) bool
+
+// WithReadRetries returns an option that retries failed reads up to n times before giving up.
+// This is useful for inputs backed by flaky storage (e.g. over the network) where errors are often transient.
+// It only affects functions that do their own reading (e.g. SumReaderAt); by default reads aren't retried.
+func WithReadRetries(n int) Option {
+	return WithRetryPolicy(func(attempt int, err error) bool {
+		return attempt <= n
+	})
+}
+
+// WithRetryPolicy returns an option that uses the given policy to decide whether to retry failed reads.
+// As with WithReadRetries it only affects functions that do their own reading.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
@@ -0,0 +1,32 @@
+package vsohash
+
+import (
+	"hash"
+)
+
+// NewPagedHash returns a new paged hash with the same structure as VSO-Hash, but using the given inner hash
+// and block / page sizes. It will perform up to the given number of calculations in parallel.
+//
+// The result is the inner hash of the final blob id; unlike VSO-Hash there is no trailing algorithm byte,
+// so Size() is the same as the inner hash's. The inner hash can be at most 64 bytes.
+// Note that the result isn't compatible with anything else; use New or NewParallel for a standard VSO-Hash.
+func NewPagedHash(newInner func() hash.Hash, blockSize, pageSize, parallelism int) hash.Hash {
+	return newPagedHash(newInner, blockSize, pageSize, parallelism, nil)
+}
+
+// NewPaged is like NewPagedHash, using SHA256 as the inner hash (as VSO-Hash does). Note that the page size
+// comes first here. With a page size of PageSize and block size of BlockSize, its result is the same as
+// VSO-Hash without the trailing algorithm byte.
+// Any options given are applied to the new hash; WithBlockCache is only permitted with the standard sizes.
+func NewPaged(pageSize, blockSize, parallelism int, opts ...Option) hash.Hash {
+	return newPagedHash(newSHA256, blockSize, pageSize, parallelism, opts)
+}
+
+func newPagedHash(newInner func() hash.Hash, blockSize, pageSize, parallelism int, opts []Option) *vsoHash {
+	if pageSize <= 0 || blockSize <= 0 {
+		panic("Block and page sizes must be strictly positive")
+	} else if blockSize%pageSize != 0 {
+		panic("Block size must be a multiple of page size")
+	}
+	return newHash(newInner, blockSize, pageSize, parallelism, nil, opts)
+}
@@ -0,0 +1,127 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPagedHashMatchesVSOHash(t *testing.T) {
+	// With SHA256 and the standard sizes, we should get the same as VSO-Hash minus the algorithm byte.
+	for _, lim := range []int{0, 1, PageSize, BlockSize - 1, BlockSize, 2*BlockSize + 1} {
+		t.Run(fmt.Sprintf("Size%d", lim), func(t *testing.T) {
+			in := sequentialInput(lim)
+			h := NewPagedHash(sha256.New, BlockSize, PageSize, 4)
+			h.Write(in)
+			expected := Sum(in)
+			assert.Equal(t, expected[:sha256.Size], h.Sum(nil))
+		})
+	}
+}
+
+func TestPaged(t *testing.T) {
+	in := sequentialInput(2*BlockSize + 1)
+	h := NewPaged(PageSize, BlockSize, 4)
+	h.Write(in)
+	expected := Sum(in)
+	assert.Equal(t, expected[:sha256.Size], h.Sum(nil))
+	h = NewPaged(1024, 4096, 3)
+	h.Write(in)
+	assert.Equal(t, pagedSum(sha256.New(), in, 4096, 1024), h.Sum(nil))
+	assert.Panics(t, func() { NewPaged(1000, 4096, 1) })
+}
+
+func TestPagedSeed(t *testing.T) {
+	in := sequentialInput(2*BlockSize + 1)
+	h1 := NewPaged(PageSize, BlockSize, 2, WithSeed("VSO Content Identifier Seed"))
+	h1.Write(in)
+	expected := Sum(in)
+	assert.Equal(t, expected[:sha256.Size], h1.Sum(nil))
+	h2 := NewPaged(PageSize, BlockSize, 2, WithSeed("some other domain"))
+	h2.Write(in)
+	assert.NotEqual(t, h1.Sum(nil), h2.Sum(nil))
+	h3 := NewPaged(PageSize, BlockSize, 2, WithSeed(""))
+	h3.Write(in)
+	assert.NotEqual(t, h1.Sum(nil), h3.Sum(nil))
+	assert.NotEqual(t, h2.Sum(nil), h3.Sum(nil))
+}
+
+func TestSeedNotPermittedForVSOHash(t *testing.T) {
+	assert.Panics(t, func() { New(WithSeed("nope")) })
+	assert.Panics(t, func() { NewSequential(WithSeed("nope")) })
+}
+
+func TestBlockCacheNotPermittedForOtherInnerHashes(t *testing.T) {
+	assert.Panics(t, func() { newPagedHash(sha512.New, BlockSize, PageSize, 2, []Option{WithBlockCache(newMapCache())}) })
+	h := newPagedHash(sha256.New, BlockSize, PageSize, 2, []Option{WithBlockCache(newMapCache())})
+	h.Close()
+}
+
+func TestPagedHashSHA512(t *testing.T) {
+	in := sequentialInput(2*BlockSize + 100)
+	h := NewPagedHash(sha512.New, BlockSize, PageSize, 4)
+	assert.Equal(t, sha512.Size, h.Size())
+	h.Write(in)
+	sum := h.Sum(nil)
+	assert.Equal(t, sha512.Size, len(sum))
+	assert.Equal(t, pagedSum(sha512.New(), in, BlockSize, PageSize), sum)
+}
+
+func TestPagedHashSmallPages(t *testing.T) {
+	// Compare against a straightforward implementation of the algorithm.
+	for _, lim := range []int{0, 1, 1023, 1024, 1025, 32767, 32768, 32769, 100000} {
+		t.Run(fmt.Sprintf("Size%d", lim), func(t *testing.T) {
+			in := sequentialInput(lim)
+			h := NewPagedHash(sha256.New, 4096, 1024, 3)
+			h.Write(in)
+			assert.Equal(t, hex.EncodeToString(pagedSum(sha256.New(), in, 4096, 1024)), hex.EncodeToString(h.Sum(nil)))
+		})
+	}
+}
+
+func TestPagedHashInvalidSizes(t *testing.T) {
+	assert.Panics(t, func() { NewPagedHash(sha256.New, 0, 1024, 1) })
+	assert.Panics(t, func() { NewPagedHash(sha256.New, 4096, 0, 1) })
+	assert.Panics(t, func() { NewPagedHash(sha256.New, 4000, 1024, 1) })
+}
+
+// pagedSum is a simple single-threaded implementation of a paged hash, to check the real one against.
+func pagedSum(h interface {
+	Write([]byte) (int, error)
+	Sum([]byte) []byte
+	Reset()
+}, in []byte, blockSize, pageSize int) []byte {
+	sum := func(b ...[]byte) []byte {
+		h.Reset()
+		for _, x := range b {
+			h.Write(x)
+		}
+		return h.Sum(nil)
+	}
+	var blobID []byte
+	for i := 0; i == 0 || i < len(in); i += blockSize {
+		block := in[i:]
+		if len(block) > blockSize {
+			block = block[:blockSize]
+		}
+		var pages []byte
+		for j := 0; j < len(block); j += pageSize {
+			page := block[j:]
+			if len(page) > pageSize {
+				page = page[:pageSize]
+			}
+			pages = append(pages, sum(page)...)
+		}
+		blockHash := sum(pages)
+		if blobID == nil {
+			blobID = append([]byte(seed), blockHash...)
+		} else {
+			blobID = append(sum(blobID, []byte{0}), blockHash...)
+		}
+	}
+	return sum(blobID, []byte{1})
+}
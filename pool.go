@@ -0,0 +1,124 @@
+package vsohash
+
+import (
+	"hash"
+	"sync"
+	"sync/atomic"
+)
+
+// A Pool is a set of worker goroutines that can be shared between many hashes.
+// Normally each hash starts its own workers; when hashing lots of inputs concurrently that can mean
+// a very large number of mostly-idle goroutines. Hashes created from a pool instead share its workers,
+// which caps the total number of page hashes being calculated at once regardless of how many hashes exist.
+type Pool struct {
+	tasks   chan hashTask
+	running sync.WaitGroup
+	closed  int32
+}
+
+// NewPool returns a new pool with the given number of workers.
+func NewPool(size int) *Pool {
+	if size <= 0 {
+		panic("Pool size must be strictly positive")
+	}
+	p := &Pool{tasks: make(chan hashTask, size)}
+	p.running.Add(size)
+	for i := 0; i < size; i++ {
+		go run(p.tasks, newSHA256, nil, nil, &p.running)
+	}
+	return p
+}
+
+// NewFromPool returns a new hash that uses the workers from the given pool.
+// WithAffinity has no effect on hashes created this way; their pages are processed by whichever worker is free.
+// The hash has no goroutines of its own, so doesn't need closing (although it's harmless to do so).
+func NewFromPool(p *Pool, opts ...Option) hash.Hash {
+	v := newUnstartedHash(newSHA256, BlockSize, PageSize, []byte{0}, opts)
+	v.tasks = p.tasks
+	v.pool = p
+	return v
+}
+
+// Close stops all the pool's workers and waits for them to exit. No hashes created from the pool may be
+// used after it's closed; once it has been, their Write and SumErr return ErrPoolClosed.
+// It must not be called while any of them are still being written to.
+func (p *Pool) Close() {
+	atomic.StoreInt32(&p.closed, 1)
+	close(p.tasks)
+	p.running.Wait()
+}
+
+// isClosed returns true if the pool has been closed.
+func (p *Pool) isClosed() bool {
+	return atomic.LoadInt32(&p.closed) != 0
+}
+
+// A HasherPool recycles whole hashes, along with their buffers and workers, so a server that hashes lots of
+// inputs doesn't have to keep creating new ones. It's safe for concurrent use.
+// As for sync.Pool (which it's built on), hashes that aren't in use may be dropped at any time; their workers
+// are then released when they're garbage collected, as for any hash that isn't closed.
+type HasherPool struct {
+	pool sync.Pool
+}
+
+// NewHasherPool returns a new HasherPool whose hashes have the given parallelism and options.
+// It panics if they include WithoutFinalizer, since dropped hashes would then never release their workers.
+func NewHasherPool(parallelism int, opts ...Option) *HasherPool {
+	if parallelism <= 0 {
+		panic("Parallelism must be strictly positive")
+	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.noFinalizer {
+		panic("WithoutFinalizer can't be used with a HasherPool")
+	}
+	p := &HasherPool{}
+	p.pool.New = func() interface{} {
+		return NewParallel(parallelism, opts...)
+	}
+	return p
+}
+
+// Acquire returns a hash from the pool, ready to use. A new one is created if there aren't any available.
+func (p *HasherPool) Acquire() Hasher {
+	return p.pool.Get().(Hasher)
+}
+
+// Release resets the given hash and returns it to the pool. It must have come from Acquire on this pool,
+// and mustn't be used again afterwards. Hashes that have been closed are discarded instead.
+func (p *HasherPool) Release(h Hasher) {
+	if v := h.(*vsoHash); !v.closed {
+		v.Reset()
+		p.pool.Put(v)
+	}
+}
+
+// SumMany calculates the VSO-Hash of each of the given inputs, returning them in the same order.
+// All the inputs share one pool of the given size, and up to that many of them are hashed at once,
+// which is much more efficient than calling Sum on each in turn when there are a lot of small ones.
+func SumMany(inputs [][]byte, parallelism int) [][Size]byte {
+	if parallelism <= 0 {
+		panic("Parallelism must be strictly positive")
+	}
+	ret := make([][Size]byte, len(inputs))
+	p := NewPool(parallelism)
+	defer p.Close()
+	var wg sync.WaitGroup
+	next := int32(-1)
+	for i := 0; i < parallelism && i < len(inputs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h := NewFromPool(p).(*vsoHash)
+			for j := int(atomic.AddInt32(&next, 1)); j < len(inputs); j = int(atomic.AddInt32(&next, 1)) {
+				h.Reset()
+				h.Write(inputs[j])
+				ret[j] = h.sum()
+			}
+		}()
+	}
+	wg.Wait()
+	return ret
+}
@@ -0,0 +1,112 @@
+package vsohash
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool(2)
+	defer p.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			in := sequentialInput(i*BlockSize/3 + i)
+			h := NewFromPool(p)
+			h.Write(in)
+			assert.Equal(t, Sum(in), sumArray(h))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestPoolDoesNotStartGoroutines(t *testing.T) {
+	p := NewPool(4)
+	defer p.Close()
+	before := runtime.NumGoroutine()
+	hashes := make([]*vsoHash, 20)
+	for i := range hashes {
+		hashes[i] = NewFromPool(p).(*vsoHash)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+	for i, h := range hashes {
+		t.Run(fmt.Sprintf("Hash%d", i), func(t *testing.T) {
+			h.Write(sequentialInput(PageSize + 1))
+			assert.Equal(t, Sum(sequentialInput(PageSize+1)), sumArray(h))
+			assert.NoError(t, h.Close())
+		})
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	p := NewPool(4)
+	h := NewFromPool(p)
+	h.Write(sequentialInput(BlockSize))
+	h.Sum(nil)
+	h.(Hasher).Close()
+	p.Close()
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func TestPoolClosedErrors(t *testing.T) {
+	p := NewPool(2)
+	h := NewFromPool(p).(Hasher)
+	h.Write(sequentialInput(PageSize + 1))
+	p.Close()
+	_, err := h.Write(sequentialInput(PageSize))
+	assert.Equal(t, ErrPoolClosed, err)
+	_, err = h.SumErr()
+	assert.Equal(t, ErrPoolClosed, err)
+}
+
+func TestHasherPool(t *testing.T) {
+	p := NewHasherPool(4)
+	in := sequentialInput(BlockSize + PageSize + 5)
+	for i := 0; i < 3; i++ {
+		h := p.Acquire()
+		h.Write(in[:PageSize+3]) // Some of this is left over when it's released.
+		p.Release(h)
+		h = p.Acquire()
+		h.Write(in)
+		assert.Equal(t, Sum(in), sumArray(h))
+		p.Release(h)
+	}
+}
+
+func TestHasherPoolDiscardsClosed(t *testing.T) {
+	p := NewHasherPool(2)
+	h := p.Acquire()
+	h.Close()
+	p.Release(h)
+	h2 := p.Acquire()
+	defer h2.Close()
+	_, err := h2.Write([]byte("hello"))
+	assert.NoError(t, err)
+}
+
+func TestHasherPoolWithoutFinalizer(t *testing.T) {
+	assert.Panics(t, func() { NewHasherPool(2, WithoutFinalizer()) })
+}
+
+func TestSumMany(t *testing.T) {
+	inputs := make([][]byte, 50)
+	for i := range inputs {
+		inputs[i] = sequentialInput(i * i * 1021)
+	}
+	sums := SumMany(inputs, 3)
+	assert.Equal(t, len(inputs), len(sums))
+	for i, in := range inputs {
+		assert.Equal(t, Sum(in), sums[i])
+	}
+}
+
+func TestSumManyEmpty(t *testing.T) {
+	assert.Equal(t, 0, len(SumMany(nil, 4)))
+}
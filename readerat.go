@@ -0,0 +1,129 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+	"hash/crc64"
+	"io"
+	"sync"
+)
+
+// SumReaderAt calculates the VSO-Hash of the first size bytes of r. Since blocks are independent
+// up until they're combined at the end, it reads and hashes up to the given number of blocks in parallel,
+// which can make much better use of fast storage than reading it sequentially.
+//
+// Options that affect reading (e.g. WithReadRetries) are respected, as are WithBlockCache,
+// WithRejectEmpty and WithRequireBlockAlignment.
+// If any read fails (after retries), the first error encountered is returned.
+// If r has fewer than size bytes, io.ErrUnexpectedEOF is returned.
+func SumReaderAt(r io.ReaderAt, size int64, parallelism int, opts ...Option) ([Size]byte, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o.sumBlocks(size, parallelism, BlockSize, func(buf []byte, offset, length int64) ([sha256.Size]byte, error) {
+		block := buf[:length]
+		if err := o.readFull(r, block, offset); err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		return o.hashBlock(block), nil
+	})
+}
+
+// sumBlocks calculates the VSO-Hash of an input of the given size by hashing its blocks in parallel.
+// The given function is called from a worker goroutine to hash each block; it's passed the offset
+// and length of the block and a buffer that it may use, which is allocated with the given size for each
+// worker (so can be zero if the function doesn't need it).
+func (o *options) sumBlocks(size int64, parallelism, bufSize int, hashBlock func(buf []byte, offset, length int64) ([sha256.Size]byte, error)) ([Size]byte, error) {
+	if parallelism <= 0 {
+		panic("Parallelism must be strictly positive")
+	}
+	if err := o.checkSize(size); err != nil {
+		return [Size]byte{}, err
+	}
+	n := BlocksFor(size)
+	if int64(parallelism) > n {
+		parallelism = int(n)
+	}
+	hashes := make([][sha256.Size]byte, n)
+	indices := make(chan int64, parallelism)
+	done := make(chan struct{})
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			close(done)
+		})
+	}
+	var wg sync.WaitGroup
+	wg.Add(parallelism)
+	for i := 0; i < parallelism; i++ {
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, bufSize)
+			for idx := range indices {
+				offset := idx * BlockSize
+				length := int64(BlockSize)
+				if remaining := size - offset; remaining < BlockSize {
+					length = remaining
+				}
+				h, err := hashBlock(buf, offset, length)
+				if err != nil {
+					fail(err)
+					return
+				}
+				hashes[idx] = h
+			}
+		}()
+	}
+feed:
+	for idx := int64(0); idx < n; idx++ {
+		select {
+		case indices <- idx:
+		case <-done:
+			break feed
+		}
+	}
+	close(indices)
+	wg.Wait()
+	if firstErr != nil {
+		return [Size]byte{}, firstErr
+	}
+	return CombineBlockHashes(hashes), nil
+}
+
+// readFull reads exactly len(buf) bytes from r at the given offset, retrying according to the retry policy.
+// Reads that make some progress before failing reset the attempt count, so the policy sees consecutive failures.
+func (o *options) readFull(r io.ReaderAt, buf []byte, offset int64) error {
+	attempt := 0
+	for {
+		n, err := r.ReadAt(buf, offset)
+		if n == len(buf) {
+			return nil // ReadAt is permitted to return io.EOF alongside a full read at the end of the input.
+		} else if err == nil || err == io.EOF {
+			return io.ErrUnexpectedEOF // The input is shorter than we were told; retrying won't help.
+		} else if n > 0 {
+			attempt = 0
+		}
+		buf = buf[n:]
+		offset += int64(n)
+		attempt++
+		if o.retry == nil || !o.retry(attempt, err) {
+			return err
+		}
+	}
+}
+
+// hashBlock returns the hash of a single block, using the block cache if there is one.
+func (o *options) hashBlock(block []byte) [sha256.Size]byte {
+	if o.cache == nil {
+		return BlockHash(block)
+	}
+	fingerprint := crc64.Checksum(block, crcTable)
+	if h, ok := o.cache.Get(fingerprint, block); ok {
+		return h
+	}
+	h := BlockHash(block)
+	o.cache.Put(fingerprint, block, h)
+	return h
+}
@@ -0,0 +1,155 @@
+package vsohash
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSumReaderAt(t *testing.T) {
+	for _, lim := range []int{0, 1, PageSize + 1, BlockSize - 1, BlockSize, BlockSize + 1, 3*BlockSize + 17} {
+		for _, parallelism := range []int{1, 4} {
+			t.Run(fmt.Sprintf("Size%dParallel%d", lim, parallelism), func(t *testing.T) {
+				in := sequentialInput(lim)
+				sum, err := SumReaderAt(bytes.NewReader(in), int64(lim), parallelism)
+				require.NoError(t, err)
+				assert.Equal(t, Sum(in), sum)
+			})
+		}
+	}
+}
+
+func TestSumReaderAtVectors(t *testing.T) {
+	for lim, hash := range blobIDVectors {
+		t.Run(fmt.Sprint(lim), func(t *testing.T) {
+			sum, err := SumReaderAt(bytes.NewReader(sequentialInput(lim)), int64(lim), 3)
+			require.NoError(t, err)
+			assert.Equal(t, hash, hex.EncodeToString(sum[:]))
+		})
+	}
+}
+
+func TestSumReaderAtReadsWholeBlocks(t *testing.T) {
+	in := sequentialInput(3*BlockSize + 17)
+	r := &recordingReaderAt{r: bytes.NewReader(in)}
+	_, err := SumReaderAt(r, int64(len(in)), 2)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{0, BlockSize, 2 * BlockSize, 3 * BlockSize}, r.offsets)
+	assert.ElementsMatch(t, []int{BlockSize, BlockSize, BlockSize, 17}, r.lengths)
+}
+
+// A recordingReaderAt records the offset & length of each read.
+type recordingReaderAt struct {
+	r       io.ReaderAt
+	mutex   sync.Mutex
+	offsets []int64
+	lengths []int
+}
+
+func (r *recordingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mutex.Lock()
+	r.offsets = append(r.offsets, off)
+	r.lengths = append(r.lengths, len(p))
+	r.mutex.Unlock()
+	return r.r.ReadAt(p, off)
+}
+
+func TestSumReaderAtShortInput(t *testing.T) {
+	in := sequentialInput(BlockSize + 1)
+	_, err := SumReaderAt(bytes.NewReader(in), BlockSize+2, 2)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestSumReaderAtRetries(t *testing.T) {
+	in := sequentialInput(3*BlockSize + 5)
+	r := &flakyReaderAt{r: bytes.NewReader(in), failures: 2}
+	sum, err := SumReaderAt(r, int64(len(in)), 2, WithReadRetries(2))
+	require.NoError(t, err)
+	assert.Equal(t, Sum(in), sum)
+}
+
+func TestSumReaderAtResumesPartialReads(t *testing.T) {
+	// Every read will only get half the data the first time. Since they're making progress the retries
+	// keep getting reset; we need two to handle the last byte (which gets no data the first time).
+	in := sequentialInput(3*BlockSize + 5)
+	r := &flakyReaderAt{r: bytes.NewReader(in), failures: 1, partial: true}
+	sum, err := SumReaderAt(r, int64(len(in)), 2, WithReadRetries(2))
+	require.NoError(t, err)
+	assert.Equal(t, Sum(in), sum)
+}
+
+func TestSumReaderAtNoRetriesByDefault(t *testing.T) {
+	in := sequentialInput(3*BlockSize + 5)
+	r := &flakyReaderAt{r: bytes.NewReader(in), failures: 1}
+	_, err := SumReaderAt(r, int64(len(in)), 2)
+	assert.Equal(t, errFlaky, err)
+}
+
+func TestSumReaderAtTooManyFailures(t *testing.T) {
+	in := sequentialInput(3*BlockSize + 5)
+	r := &flakyReaderAt{r: bytes.NewReader(in), failures: 3}
+	_, err := SumReaderAt(r, int64(len(in)), 2, WithReadRetries(2))
+	assert.Equal(t, errFlaky, err)
+}
+
+func TestSumReaderAtRetryPolicy(t *testing.T) {
+	in := sequentialInput(BlockSize + 5)
+	r := &flakyReaderAt{r: bytes.NewReader(in), failures: 5}
+	var mutex sync.Mutex
+	attempts := 0
+	sum, err := SumReaderAt(r, int64(len(in)), 1, WithRetryPolicy(func(attempt int, err error) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts++
+		return errors.Is(err, errFlaky)
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, Sum(in), sum)
+	assert.Equal(t, 10, attempts)
+}
+
+var errFlaky = errors.New("flaky read")
+
+// flakyReaderAt fails each read at a new offset a given number of times before succeeding.
+// If partial is set it returns half the data before failing, to check that partial reads are resumed correctly.
+type flakyReaderAt struct {
+	r        io.ReaderAt
+	failures int
+	partial  bool
+	mutex    sync.Mutex
+	seen     map[int64]int
+}
+
+func (f *flakyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.seen == nil {
+		f.seen = map[int64]int{}
+	}
+	if f.seen[off] < f.failures {
+		f.seen[off]++
+		if !f.partial {
+			return 0, errFlaky
+		}
+		n, _ := f.r.ReadAt(p[:len(p)/2], off)
+		return n, errFlaky
+	}
+	return f.r.ReadAt(p, off)
+}
+
+func TestSumReaderAtRejectEmpty(t *testing.T) {
+	_, err := SumReaderAt(bytes.NewReader(nil), 0, 1, WithRejectEmpty(true))
+	assert.Equal(t, ErrEmptyInput, err)
+}
+
+func TestSumReaderAtRequireBlockAlignment(t *testing.T) {
+	_, err := SumReaderAt(bytes.NewReader(sequentialInput(PageSize)), PageSize, 1, WithRequireBlockAlignment(true))
+	assert.Equal(t, &BlockAlignmentError{Size: PageSize}, err)
+}
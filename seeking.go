@@ -0,0 +1,72 @@
+package vsohash
+
+import (
+	"errors"
+	"hash"
+	"io"
+)
+
+// ErrInvalidSeek is returned when a SeekingHasher is asked to seek anywhere other than the start
+// of the stream (or its current position).
+var ErrInvalidSeek = errors.New("vsohash: SeekingHasher can only seek to the start of the stream")
+
+// A SeekingHasher wraps an io.ReadSeeker and hashes everything read through it.
+// If it's seeked back to the start, the hash is reset and the content will be hashed again
+// as it's reread; this supports things like HTTP clients which retry a request by rewinding the body.
+//
+// Seeking to any other position would leave a gap (or overlap) in the hashed content, so it
+// returns ErrInvalidSeek and leaves the position unchanged. Seeking to the current position is
+// permitted and doesn't affect anything.
+//
+// It should be closed once it's no longer needed.
+type SeekingHasher struct {
+	rs   io.ReadSeeker
+	hash hash.Hash
+	pos  int64
+}
+
+// NewSeekingHasher returns a new SeekingHasher wrapping the given reader.
+// It's assumed to be positioned at the start of the stream.
+func NewSeekingHasher(rs io.ReadSeeker) *SeekingHasher {
+	return &SeekingHasher{rs: rs, hash: New()}
+}
+
+// Read implements io.Reader, hashing all bytes that are read.
+func (s *SeekingHasher) Read(p []byte) (int, error) {
+	n, err := s.rs.Read(p)
+	s.hash.Write(p[:n])
+	s.pos += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker. See the type documentation for which seeks are permitted.
+func (s *SeekingHasher) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekCurrent && offset == 0 || whence == io.SeekStart && offset == s.pos {
+		return s.pos, nil
+	} else if whence == io.SeekCurrent && offset == -s.pos {
+		offset = 0
+	} else if whence != io.SeekStart || offset != 0 {
+		return s.pos, ErrInvalidSeek
+	}
+	if _, err := s.rs.Seek(0, io.SeekStart); err != nil {
+		return s.pos, err
+	}
+	s.hash.Reset()
+	s.pos = 0
+	return 0, nil
+}
+
+// Close releases the hash's workers, and closes the underlying reader if it's an io.Closer (so the
+// SeekingHasher can be used as an HTTP request body, for example). Sum can still be called afterwards.
+func (s *SeekingHasher) Close() error {
+	s.hash.(io.Closer).Close()
+	if c, ok := s.rs.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Sum returns the hash of everything read since the last time the stream was at its start.
+func (s *SeekingHasher) Sum() [Size]byte {
+	return s.hash.(*vsoHash).sum()
+}
@@ -0,0 +1,81 @@
+package vsohash
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeekingHasherRereads(t *testing.T) {
+	in := sequentialInput(BlockSize + PageSize + 1)
+	s := NewSeekingHasher(bytes.NewReader(in))
+	// Read part of it, then go back and read the whole thing.
+	buf := make([]byte, PageSize+5)
+	_, err := io.ReadFull(s, buf)
+	require.NoError(t, err)
+	pos, err := s.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, pos)
+	n, err := io.Copy(io.Discard, s)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(in), n)
+	assert.Equal(t, Sum(in), s.Sum())
+}
+
+func TestSeekingHasherSeekCurrent(t *testing.T) {
+	in := sequentialInput(PageSize * 3)
+	s := NewSeekingHasher(bytes.NewReader(in))
+	_, err := io.ReadFull(s, make([]byte, 100))
+	require.NoError(t, err)
+	pos, err := s.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.EqualValues(t, 100, pos)
+	pos, err = s.Seek(-100, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, pos)
+	_, err = io.Copy(io.Discard, s)
+	require.NoError(t, err)
+	assert.Equal(t, Sum(in), s.Sum())
+}
+
+func TestSeekingHasherInvalidSeek(t *testing.T) {
+	in := sequentialInput(PageSize)
+	s := NewSeekingHasher(bytes.NewReader(in))
+	_, err := io.ReadFull(s, make([]byte, 100))
+	require.NoError(t, err)
+	pos, err := s.Seek(50, io.SeekStart)
+	assert.Equal(t, ErrInvalidSeek, err)
+	assert.EqualValues(t, 100, pos)
+	_, err = s.Seek(0, io.SeekEnd)
+	assert.Equal(t, ErrInvalidSeek, err)
+	// We should still be able to carry on reading as before.
+	_, err = io.Copy(io.Discard, s)
+	require.NoError(t, err)
+	assert.Equal(t, Sum(in), s.Sum())
+}
+
+// closeRecorder is a bytes.Reader that records whether it's been closed.
+type closeRecorder struct {
+	*bytes.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestSeekingHasherClose(t *testing.T) {
+	in := sequentialInput(BlockSize + 10)
+	r := &closeRecorder{Reader: bytes.NewReader(in)}
+	s := NewSeekingHasher(r)
+	_, err := io.ReadFull(s, make([]byte, PageSize))
+	require.NoError(t, err)
+	assert.NoError(t, s.Close())
+	assert.True(t, r.closed)
+	assert.True(t, s.hash.(*vsoHash).closed)
+	assert.Equal(t, Sum(in[:PageSize]), s.Sum())
+}
@@ -0,0 +1,81 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+)
+
+// A SegmentHasher calculates the VSO-Hash of an input of known size from block-aligned segments of it,
+// which can be added in any order. This suits e.g. a downloader that fetches ranges of a file in parallel;
+// since blocks are hashed independently, each one can be hashed as soon as it arrives and only the (cheap)
+// blob id calculation has to wait for all of them.
+//
+// It's safe to call Add from multiple goroutines at once, in which case their segments are hashed in parallel.
+type SegmentHasher struct {
+	size   int64
+	mutex  sync.Mutex
+	hashes [][sha256.Size]byte
+	added  []bool
+}
+
+// NewSegmentHasher returns a new SegmentHasher for an input of the given size.
+// It panics if size is negative.
+func NewSegmentHasher(size int64) *SegmentHasher {
+	n := BlocksFor(size)
+	return &SegmentHasher{
+		size:   size,
+		hashes: make([][sha256.Size]byte, n),
+		added:  make([]bool, n),
+	}
+}
+
+// Add adds a segment of the input, which starts at the block with the given index. It can be any number of whole
+// blocks, except that the last block of the input may be shorter as usual (so e.g. a segment of one block
+// can be BlockSize long, or less if it's the last one). Each block can only be added once.
+// It returns an error if the segment doesn't fit those criteria, in which case none of it is added.
+func (s *SegmentHasher) Add(index int, data []byte) error {
+	if index < 0 || index >= len(s.hashes) {
+		return fmt.Errorf("vsohash: segment index %d out of range (input has %d blocks)", index, len(s.hashes))
+	}
+	offset := int64(index) * BlockSize
+	if end := offset + int64(len(data)); end > s.size {
+		return fmt.Errorf("vsohash: segment at block %d of length %d extends past the end of the input", index, len(data))
+	} else if end != s.size && len(data)%BlockSize != 0 {
+		return fmt.Errorf("vsohash: segment at block %d of length %d isn't a whole number of blocks", index, len(data))
+	} else if len(data) == 0 && s.size != 0 {
+		return fmt.Errorf("vsohash: segment at block %d is empty", index)
+	}
+	hashes := make([][sha256.Size]byte, NumBlocks(int64(len(data))))
+	for i := range hashes {
+		end := (i + 1) * BlockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		hashes[i] = BlockHash(data[i*BlockSize : end])
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := range hashes {
+		if s.added[index+i] {
+			return fmt.Errorf("vsohash: block %d has already been added", index+i)
+		}
+	}
+	for i, h := range hashes {
+		s.hashes[index+i] = h
+		s.added[index+i] = true
+	}
+	return nil
+}
+
+// Finalize returns the VSO-Hash of the input. It returns an error if any of its blocks haven't been added.
+func (s *SegmentHasher) Finalize() ([Size]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i, added := range s.added {
+		if !added {
+			return [Size]byte{}, fmt.Errorf("vsohash: block %d hasn't been added", i)
+		}
+	}
+	return CombineBlockHashes(s.hashes), nil
+}
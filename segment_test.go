@@ -0,0 +1,65 @@
+package vsohash
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentHasher(t *testing.T) {
+	for _, lim := range []int{0, 1, BlockSize, BlockSize + 1, 5*BlockSize + 17} {
+		t.Run(fmt.Sprint(lim), func(t *testing.T) {
+			in := sequentialInput(lim)
+			s := NewSegmentHasher(int64(lim))
+			n := NumBlocks(int64(lim))
+			var wg sync.WaitGroup
+			for _, i := range rand.Perm(n) {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					end := (i + 1) * BlockSize
+					if end > lim {
+						end = lim
+					}
+					assert.NoError(t, s.Add(i, in[i*BlockSize:end]))
+				}(i)
+			}
+			wg.Wait()
+			sum, err := s.Finalize()
+			require.NoError(t, err)
+			assert.Equal(t, Sum(in), sum)
+		})
+	}
+}
+
+func TestSegmentHasherMultipleBlocks(t *testing.T) {
+	in := sequentialInput(5*BlockSize + 17)
+	s := NewSegmentHasher(int64(len(in)))
+	require.NoError(t, s.Add(3, in[3*BlockSize:]))
+	require.NoError(t, s.Add(0, in[:2*BlockSize]))
+	_, err := s.Finalize()
+	assert.Error(t, err) // Block 2 is missing
+	require.NoError(t, s.Add(2, in[2*BlockSize:3*BlockSize]))
+	sum, err := s.Finalize()
+	require.NoError(t, err)
+	assert.Equal(t, Sum(in), sum)
+}
+
+func TestSegmentHasherInvalid(t *testing.T) {
+	in := sequentialInput(3*BlockSize + 17)
+	s := NewSegmentHasher(int64(len(in)))
+	assert.Error(t, s.Add(-1, in[:BlockSize]))
+	assert.Error(t, s.Add(4, in[:17]))
+	assert.Error(t, s.Add(0, in[:BlockSize-1]))          // Not a whole block
+	assert.Error(t, s.Add(3, in[3*BlockSize-1:]))        // Past the end
+	assert.Error(t, s.Add(3, in[3*BlockSize:len(in)-1])) // Short last block
+	assert.Error(t, s.Add(1, nil))
+	require.NoError(t, s.Add(1, in[BlockSize:2*BlockSize]))
+	assert.Error(t, s.Add(0, in[:2*BlockSize])) // Overlaps one that's already there
+	_, err := s.Finalize()
+	assert.Error(t, err)
+}
@@ -0,0 +1,20 @@
+//go:build sha256simd
+
+package vsohash
+
+import (
+	"crypto/sha256"
+
+	simd "github.com/minio/sha256-simd"
+)
+
+// newSHA256 returns the SHA256 implementation used for all the VSO-Hash calculations.
+// With the sha256simd tag that's github.com/minio/sha256-simd, which uses the SHA extensions on amd64 & arm64
+// where they're available. Note that recent versions of Go do that in crypto/sha256 as well, so this is mostly
+// useful with older toolchains.
+var newSHA256 = simd.New
+
+// sum256 returns the SHA256 of the given data, using the same implementation as newSHA256.
+func sum256(data []byte) [sha256.Size]byte {
+	return simd.Sum256(data)
+}
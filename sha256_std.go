@@ -0,0 +1,17 @@
+//go:build !sha256simd
+
+package vsohash
+
+import (
+	"crypto/sha256"
+)
+
+// newSHA256 returns the SHA256 implementation used for all the VSO-Hash calculations.
+// By default that's the standard library's; building with the sha256simd tag swaps it for
+// github.com/minio/sha256-simd (see sha256_simd.go).
+var newSHA256 = sha256.New
+
+// sum256 returns the SHA256 of the given data, using the same implementation as newSHA256.
+func sum256(data []byte) [sha256.Size]byte {
+	return sha256.Sum256(data)
+}
@@ -0,0 +1,54 @@
+package vsohash
+
+// BlocksFor returns the number of blocks that an input of the given size is hashed as.
+// Note that an empty input is still hashed as a single (empty) block, so this never returns less than 1.
+//
+// It panics if size is negative.
+func BlocksFor(size int64) int64 {
+	if n := divRoundUp(size, BlockSize); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// PagesFor returns the number of pages that an input of the given size is split into.
+// Unlike BlocksFor, an empty input has no pages.
+//
+// It panics if size is negative.
+func PagesFor(size int64) int64 {
+	return divRoundUp(size, PageSize)
+}
+
+// divRoundUp returns size / n, rounded up.
+// This is done without the usual (size + n - 1) / n since that overflows for sizes near math.MaxInt64.
+func divRoundUp(size, n int64) int64 {
+	if size < 0 {
+		panic("Size must not be negative")
+	}
+	if size%n != 0 {
+		return size/n + 1
+	}
+	return size / n
+}
+
+// NumBlocks is like BlocksFor, but returns an int for convenience when e.g. allocating a slice of block hashes.
+// On 32-bit platforms the result overflows for inputs of more than 4 petabytes.
+func NumBlocks(size int64) int {
+	return int(BlocksFor(size))
+}
+
+// NumPages is like PagesFor, but returns an int. As for NumBlocks, this overflows on 32-bit platforms for
+// very large inputs (more than 128 terabytes).
+func NumPages(size int64) int {
+	return int(PagesFor(size))
+}
+
+// BlockIndexForOffset returns the index of the block that the byte at the given offset is in.
+//
+// It panics if offset is negative.
+func BlockIndexForOffset(offset int64) int {
+	if offset < 0 {
+		panic("Offset must not be negative")
+	}
+	return int(offset / BlockSize)
+}
@@ -0,0 +1,68 @@
+package vsohash
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlocksFor(t *testing.T) {
+	assert.EqualValues(t, 1, BlocksFor(0))
+	assert.EqualValues(t, 1, BlocksFor(1))
+	assert.EqualValues(t, 1, BlocksFor(BlockSize-1))
+	assert.EqualValues(t, 1, BlocksFor(BlockSize))
+	assert.EqualValues(t, 2, BlocksFor(BlockSize+1))
+	assert.EqualValues(t, 2, BlocksFor(2*BlockSize))
+}
+
+func TestPagesFor(t *testing.T) {
+	assert.EqualValues(t, 0, PagesFor(0))
+	assert.EqualValues(t, 1, PagesFor(1))
+	assert.EqualValues(t, 1, PagesFor(PageSize))
+	assert.EqualValues(t, 2, PagesFor(PageSize+1))
+	assert.EqualValues(t, PagesPerBlock, PagesFor(BlockSize))
+}
+
+func TestSizesDoNotOverflow(t *testing.T) {
+	// MaxInt64 is one less than a power of two, so it's always one short of an exact number of blocks / pages.
+	assert.EqualValues(t, math.MaxInt64/BlockSize+1, BlocksFor(math.MaxInt64))
+	assert.EqualValues(t, math.MaxInt64/PageSize+1, PagesFor(math.MaxInt64))
+	assert.EqualValues(t, math.MaxInt64/BlockSize+1, BlocksFor(math.MaxInt64-BlockSize+2))
+	assert.EqualValues(t, math.MaxInt64/BlockSize, BlocksFor(math.MaxInt64/BlockSize*BlockSize))
+	assert.True(t, BlocksFor(math.MaxInt64) > 0)
+	assert.True(t, PagesFor(math.MaxInt64) > 0)
+}
+
+func TestSizesPanicOnNegative(t *testing.T) {
+	assert.Panics(t, func() { BlocksFor(-1) })
+	assert.Panics(t, func() { PagesFor(math.MinInt64) })
+}
+
+func TestNumBlocks(t *testing.T) {
+	assert.Equal(t, 1, NumBlocks(0))
+	assert.Equal(t, 1, NumBlocks(BlockSize))
+	assert.Equal(t, 2, NumBlocks(BlockSize+1))
+	assert.Equal(t, 3, NumBlocks(3*BlockSize-1))
+}
+
+func TestNumPages(t *testing.T) {
+	assert.Equal(t, 0, NumPages(0))
+	assert.Equal(t, 1, NumPages(PageSize-1))
+	assert.Equal(t, 1, NumPages(PageSize))
+	assert.Equal(t, 2, NumPages(PageSize+1))
+	assert.Equal(t, PagesPerBlock+1, NumPages(BlockSize+1))
+}
+
+func TestBlockIndexForOffset(t *testing.T) {
+	assert.Equal(t, 0, BlockIndexForOffset(0))
+	assert.Equal(t, 0, BlockIndexForOffset(BlockSize-1))
+	assert.Equal(t, 1, BlockIndexForOffset(BlockSize))
+	assert.Equal(t, 1, BlockIndexForOffset(2*BlockSize-1))
+	assert.Equal(t, 2, BlockIndexForOffset(2*BlockSize))
+	// The last byte of an input is always in its last block.
+	for _, size := range []int64{1, BlockSize - 1, BlockSize, BlockSize + 1, 5 * BlockSize} {
+		assert.Equal(t, NumBlocks(size)-1, BlockIndexForOffset(size-1))
+	}
+	assert.Panics(t, func() { BlockIndexForOffset(-1) })
+}
@@ -0,0 +1,62 @@
+package vsohash
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// Scan implements sql.Scanner. It accepts either the raw bytes of an identifier or its hex encoding
+// (as produced by Value or String), as a string or []byte. NULL is an error; use NullContentID for
+// columns that can be NULL.
+func (id *ContentID) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		if len(src) == Size {
+			var b ContentID
+			copy(b[:], src)
+			if err := checkAlgorithm(b); err != nil {
+				return fmt.Errorf("vsohash: invalid content id %x: %w", src, err)
+			}
+			*id = b
+			return nil
+		}
+		return id.UnmarshalText(src)
+	case string:
+		return id.UnmarshalText([]byte(src))
+	case nil:
+		return errors.New("vsohash: can't scan NULL into a ContentID")
+	default:
+		return fmt.Errorf("vsohash: can't scan %T into a ContentID", src)
+	}
+}
+
+// Value implements driver.Valuer. The identifier is stored as lowercase hex, as for String.
+func (id ContentID) Value() (driver.Value, error) {
+	return id.String(), nil
+}
+
+// A NullContentID is a ContentID that may be NULL, for use with nullable database columns (as for sql.NullString).
+type NullContentID struct {
+	ID ContentID
+	// Valid is true if ID is not NULL.
+	Valid bool
+}
+
+// Scan implements sql.Scanner. It accepts the same things as ContentID's Scan, or NULL.
+func (n *NullContentID) Scan(src interface{}) error {
+	if src == nil {
+		n.ID, n.Valid = ContentID{}, false
+		return nil
+	}
+	n.Valid = true
+	return n.ID.Scan(src)
+}
+
+// Value implements driver.Valuer.
+func (n NullContentID) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.ID.Value()
+}
@@ -0,0 +1,73 @@
+package vsohash
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ sql.Scanner   = (*ContentID)(nil)
+	_ driver.Valuer = ContentID{}
+	_ sql.Scanner   = (*NullContentID)(nil)
+	_ driver.Valuer = NullContentID{}
+)
+
+func TestContentIDScan(t *testing.T) {
+	expected := SumID([]byte("hello"))
+	for name, src := range map[string]interface{}{
+		"Raw":         expected[:],
+		"HexBytes":    []byte(expected.String()),
+		"HexString":   expected.String(),
+		"UpperString": FormatIdentifier(expected)[len("VSO0:"):],
+	} {
+		t.Run(name, func(t *testing.T) {
+			var id ContentID
+			require.NoError(t, id.Scan(src))
+			assert.Equal(t, expected, id)
+		})
+	}
+}
+
+func TestContentIDScanInvalid(t *testing.T) {
+	var id ContentID
+	bad := SumID(nil)
+	bad[Size-1] = 1
+	assert.Error(t, id.Scan(bad[:]))
+	assert.Error(t, id.Scan("abcd"))
+	assert.Error(t, id.Scan(42))
+	assert.Error(t, id.Scan(nil))
+	assert.Equal(t, ContentID{}, id)
+}
+
+func TestContentIDValue(t *testing.T) {
+	id := SumID([]byte("hello"))
+	v, err := id.Value()
+	require.NoError(t, err)
+	assert.Equal(t, id.String(), v)
+	var id2 ContentID
+	require.NoError(t, id2.Scan(v))
+	assert.Equal(t, id, id2)
+}
+
+func TestNullContentID(t *testing.T) {
+	var n NullContentID
+	require.NoError(t, n.Scan(nil))
+	assert.False(t, n.Valid)
+	v, err := n.Value()
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	id := SumID([]byte("hello"))
+	require.NoError(t, n.Scan(id.String()))
+	assert.True(t, n.Valid)
+	assert.Equal(t, id, n.ID)
+	v, err = n.Value()
+	require.NoError(t, err)
+	assert.Equal(t, id.String(), v)
+	require.NoError(t, n.Scan(nil))
+	assert.Equal(t, NullContentID{}, n)
+}
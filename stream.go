@@ -0,0 +1,132 @@
+package vsohash
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// SumStreaming hashes everything read from r. Each time a block is completed, the identifier of
+// the content up to that point is sent on the returned channel; at EOF the final identifier is sent
+// and the channel closed. This is useful for resumable uploads which want to know the identifier as
+// of each block boundary.
+//
+// If reading fails, the identifier channel is closed without sending a final identifier and the
+// error is sent on the error channel. The error channel is closed once hashing is done, so after
+// draining the identifier channel, callers should receive once from it to check for errors.
+//
+// Identifiers are sent unbuffered, so the caller must keep receiving until the channel is closed;
+// use SumStreamingContext to be able to stop early.
+func SumStreaming(r io.Reader) (<-chan [Size]byte, <-chan error) {
+	return SumStreamingContext(context.Background(), r)
+}
+
+// SumStreamingContext is like SumStreaming, but stops if ctx is cancelled, in which case ctx.Err()
+// is sent on the error channel. As for SumReader, a single read that blocks indefinitely can't be
+// interrupted.
+func SumStreamingContext(ctx context.Context, r io.Reader) (<-chan [Size]byte, <-chan error) {
+	ids := make(chan [Size]byte)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(ids)
+		h := New(withContext(ctx)).(*vsoHash)
+		defer h.Close()
+		send := func(id [Size]byte) bool {
+			select {
+			case ids <- id:
+				return true
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return false
+			}
+		}
+		buf := make([]byte, BlockSize)
+		for {
+			// Reading whole blocks means every full read completes exactly one block.
+			n, err := io.ReadFull(r, buf)
+			if _, err := h.Write(buf[:n]); err != nil {
+				errs <- err
+				return
+			}
+			if n == BlockSize && !send(h.identifier()) {
+				return
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				if n > 0 || h.blocks == 0 {
+					// We've got a partial block that nobody's seen yet (or nothing at all).
+					send(h.sum())
+				}
+				return
+			} else if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	return ids, errs
+}
+
+// SumStdin calculates the VSO-Hash of everything read from os.Stdin until EOF.
+// Input is streamed so it can be arbitrarily large.
+func SumStdin() ([Size]byte, error) {
+	return sumReader(os.Stdin)
+}
+
+// SumConcat calculates the VSO-Hash of everything read from first until EOF followed by everything read
+// from second, as though they were a single stream. This is convenient for e.g. hashing a header and body
+// together. The split between them doesn't need to be aligned to anything; a page (or block) that
+// straddles the two is hashed exactly as it would be if the content were contiguous.
+func SumConcat(first, second io.Reader) ([Size]byte, error) {
+	return sumReader(io.MultiReader(first, second))
+}
+
+// SumChan calculates the VSO-Hash of all the chunks received from ch, in order. The caller must close ch
+// once it's sent everything, and SumChan returns once it's drained it; if ch is never closed it never returns.
+// Each chunk is finished with before the next is received, so the producer can reuse a chunk once it's
+// sent another one.
+func SumChan(ch <-chan []byte) [Size]byte {
+	h := New().(*vsoHash)
+	defer h.Close()
+	for chunk := range ch {
+		h.Write(chunk)
+	}
+	return h.sum()
+}
+
+// SumReader calculates the VSO-Hash of everything read from r until EOF. Input is streamed so it
+// can be arbitrarily large.
+// If ctx is cancelled, it stops reading and returns ctx.Err(); that's checked between reads, so
+// a single read that blocks indefinitely can't be interrupted.
+func SumReader(ctx context.Context, r io.Reader, opts ...Option) ([Size]byte, error) {
+	return sumReader(r, append(opts, withContext(ctx))...)
+}
+
+// sumReader calculates the VSO-Hash of everything read from r until EOF.
+func sumReader(r io.Reader, opts ...Option) ([Size]byte, error) {
+	d, err := digestReader(r, opts...)
+	return d.Hash, err
+}
+
+// digestReader is like sumReader but also returns the number of bytes read.
+func digestReader(r io.Reader, opts ...Option) (Digest, error) {
+	h := New(opts...).(*vsoHash)
+	defer h.Close()
+	buf := make([]byte, BlockSize)
+	for {
+		// Whole blocks mean every Write completes pages without needing to copy them into the buffer.
+		n, err := io.ReadFull(r, buf)
+		if _, err := h.Write(buf[:n]); err != nil {
+			return Digest{}, err
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			sum, err := h.SumErr()
+			if err != nil {
+				return Digest{}, err
+			}
+			return Digest{Hash: sum, Size: h.BytesWritten()}, nil
+		} else if err != nil {
+			return Digest{}, err
+		}
+	}
+}
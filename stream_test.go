@@ -0,0 +1,159 @@
+package vsohash
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSumStreaming(t *testing.T) {
+	for _, lim := range []int{0, 1, BlockSize - 1, BlockSize, BlockSize + 1, 2 * BlockSize, 2*BlockSize + PageSize} {
+		t.Run(fmt.Sprintf("Size%d", lim), func(t *testing.T) {
+			in := sequentialInput(lim)
+			ids, errs := SumStreaming(bytes.NewReader(in))
+			var received [][Size]byte
+			for id := range ids {
+				received = append(received, id)
+			}
+			assert.NoError(t, <-errs)
+			// We should have one identifier for each prefix ending at a block boundary, then the whole thing.
+			var expected [][Size]byte
+			for i := BlockSize; i < lim; i += BlockSize {
+				expected = append(expected, Sum(in[:i]))
+			}
+			expected = append(expected, Sum(in))
+			assert.Equal(t, expected, received)
+		})
+	}
+}
+
+func TestSumStreamingError(t *testing.T) {
+	r := io.MultiReader(bytes.NewReader(sequentialInput(BlockSize+1)), &errorReader{err: errors.New("kaboom")})
+	ids, errs := SumStreaming(r)
+	var received [][Size]byte
+	for id := range ids {
+		received = append(received, id)
+	}
+	assert.EqualError(t, <-errs, "kaboom")
+	// We should still have had the identifier for the first block, but not a final one.
+	assert.Equal(t, [][Size]byte{Sum(sequentialInput(BlockSize))}, received)
+}
+
+func TestSumStreamingCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ids, errs := SumStreamingContext(ctx, bytes.NewReader(sequentialInput(4*BlockSize)))
+	<-ids
+	// We stop reading ids here; the goroutine should still finish.
+	cancel()
+	assert.Equal(t, context.Canceled, <-errs)
+	for range ids {
+	}
+	// Wait for the goroutine to finish completely, so it doesn't upset the tests that count goroutines.
+	for range errs {
+	}
+}
+
+// errorReader is an io.Reader that always fails with the given error.
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestSumStdin(t *testing.T) {
+	in := sequentialInput(2*BlockSize + PageSize + 1)
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.Write(in)
+	require.NoError(t, err)
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = stdin }()
+	sum, err := SumStdin()
+	require.NoError(t, err)
+	assert.Equal(t, Sum(in), sum)
+}
+
+func TestSumConcat(t *testing.T) {
+	in := sequentialInput(2*BlockSize + 3*PageSize)
+	for _, split := range []int{0, 1, PageSize / 2, PageSize, PageSize + 7, BlockSize - 1, BlockSize, len(in)} {
+		t.Run(fmt.Sprintf("Split%d", split), func(t *testing.T) {
+			sum, err := SumConcat(bytes.NewReader(in[:split]), bytes.NewReader(in[split:]))
+			require.NoError(t, err)
+			assert.Equal(t, Sum(in), sum)
+		})
+	}
+}
+
+func TestSumConcatError(t *testing.T) {
+	_, err := SumConcat(bytes.NewReader([]byte("header")), &errorReader{err: errors.New("kaboom")})
+	assert.EqualError(t, err, "kaboom")
+}
+
+func TestSumChan(t *testing.T) {
+	in := sequentialInput(2*BlockSize + 3*PageSize + 5)
+	// Chunks that don't line up with pages. This is all sent up front (rather than by another goroutine)
+	// so nothing is left running afterwards to upset the tests that count goroutines.
+	ch := make(chan []byte, len(in)/(PageSize+11)+1)
+	for rest := in; len(rest) > 0; {
+		n := PageSize + 11
+		if n > len(rest) {
+			n = len(rest)
+		}
+		ch <- rest[:n]
+		rest = rest[n:]
+	}
+	close(ch)
+	assert.Equal(t, Sum(in), SumChan(ch))
+}
+
+func TestSumChanEmpty(t *testing.T) {
+	ch := make(chan []byte)
+	close(ch)
+	assert.Equal(t, EmptyHash, SumChan(ch))
+}
+
+func TestSumReader(t *testing.T) {
+	in := sequentialInput(3*BlockSize + PageSize + 1)
+	sum, err := SumReader(context.Background(), bytes.NewReader(in))
+	require.NoError(t, err)
+	assert.Equal(t, Sum(in), sum)
+}
+
+func TestSumReaderCancelled(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &cancellingReader{r: bytes.NewReader(sequentialInput(10 * BlockSize)), cancel: cancel}
+	_, err := SumReader(ctx, r)
+	assert.Equal(t, context.Canceled, err)
+	// It should have stopped a long way before the end of the input.
+	assert.Less(t, r.read, 2*BlockSize)
+	waitForGoroutines(t, before)
+}
+
+// cancellingReader is an io.Reader that cancels a context after its first read.
+type cancellingReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+	read   int
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += n
+	r.cancel()
+	return n, err
+}
@@ -0,0 +1,34 @@
+package vsohash
+
+import "io"
+
+// NewTeeReader returns a reader that reads from r and writes everything it reads to a new hash, which is
+// also returned. This is like io.TeeReader, so the content can be hashed as a side effect of reading it for
+// some other purpose; once the reader has reached EOF the hash's Sum gives the identifier of all of it.
+// The caller should Close the hash once they're done with it.
+func NewTeeReader(r io.Reader, opts ...Option) (io.Reader, Hasher) {
+	h := New(opts...).(*vsoHash)
+	return io.TeeReader(r, h), h
+}
+
+// NewTeeWriter returns a writer that writes to dst, and also writes to a new hash which is returned.
+// This is useful to calculate the identifier of some content in the same pass as e.g. writing it to disk.
+// Only the bytes that dst accepts are hashed, so if it fails partway through (in which case the error
+// is returned from Write) the hash is of exactly what was written to it.
+func NewTeeWriter(dst io.Writer, opts ...Option) (io.Writer, Hasher) {
+	h := New(opts...).(*vsoHash)
+	return &teeWriter{dst: dst, h: h}, h
+}
+
+type teeWriter struct {
+	dst io.Writer
+	h   *vsoHash
+}
+
+func (w *teeWriter) Write(p []byte) (int, error) {
+	n, err := w.dst.Write(p)
+	if _, err := w.h.Write(p[:n]); err != nil {
+		return n, err
+	}
+	return n, err
+}
@@ -0,0 +1,60 @@
+package vsohash
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeeReader(t *testing.T) {
+	in := sequentialInput(2*BlockSize + PageSize + 1)
+	r, h := NewTeeReader(bytes.NewReader(in))
+	defer h.Close()
+	var buf bytes.Buffer
+	// A small buffer means the reads don't line up with pages.
+	_, err := io.CopyBuffer(struct{ io.Writer }{&buf}, struct{ io.Reader }{r}, make([]byte, 1000))
+	assert.NoError(t, err)
+	assert.Equal(t, in, buf.Bytes())
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestTeeWriter(t *testing.T) {
+	in := sequentialInput(2*BlockSize + PageSize + 1)
+	var buf bytes.Buffer
+	w, h := NewTeeWriter(&buf)
+	defer h.Close()
+	_, err := io.CopyBuffer(w, struct{ io.Reader }{bytes.NewReader(in)}, make([]byte, 1000))
+	assert.NoError(t, err)
+	assert.Equal(t, in, buf.Bytes())
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestTeeWriterError(t *testing.T) {
+	in := sequentialInput(BlockSize + 1)
+	w, h := NewTeeWriter(&limitedWriter{limit: PageSize + 3})
+	defer h.Close()
+	n, err := w.Write(in)
+	assert.Equal(t, errShortWrite, err)
+	assert.Equal(t, PageSize+3, n)
+	assert.Equal(t, Sum(in[:n]), sumArray(h))
+}
+
+var errShortWrite = errors.New("short write")
+
+// A limitedWriter accepts up to a limited number of bytes, then fails.
+type limitedWriter struct {
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.limit {
+		w.limit -= len(p)
+		return len(p), nil
+	}
+	n := w.limit
+	w.limit = 0
+	return n, errShortWrite
+}
@@ -0,0 +1,175 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrHashMismatch is returned by a verifying reader when its input doesn't have the expected hash.
+var ErrHashMismatch = errors.New("vsohash: content doesn't match expected hash")
+
+// A BlockMismatchError is returned by a reader from NewBlockVerifyingReader when one of the input's
+// blocks doesn't have the expected hash. It matches ErrHashMismatch with errors.Is.
+type BlockMismatchError struct {
+	// The index of the first block that didn't match.
+	Index int
+}
+
+func (err *BlockMismatchError) Error() string {
+	return fmt.Sprintf("vsohash: block %d doesn't match expected hash", err.Index)
+}
+
+// Is returns true if target is ErrHashMismatch.
+func (err *BlockMismatchError) Is(target error) bool {
+	return target == ErrHashMismatch
+}
+
+// A ReadError is returned by VerifyReader when reading from its input fails, to distinguish that from
+// the input simply not matching.
+type ReadError struct {
+	Err error
+}
+
+func (err *ReadError) Error() string {
+	return fmt.Sprintf("vsohash: failed to read input: %s", err.Err)
+}
+
+// Unwrap returns the underlying read error.
+func (err *ReadError) Unwrap() error {
+	return err.Err
+}
+
+// Verify returns true if the VSO-Hash of data is the expected one.
+// The comparison is done in constant time, so doesn't leak anything about how much of it matched.
+func Verify(data []byte, expected [Size]byte) bool {
+	return verify(Sum(data), expected)
+}
+
+// VerifyReader is like Verify but hashes everything read from r until EOF. Input is streamed so it can be
+// arbitrarily large. If reading fails, it returns false and a *ReadError.
+func VerifyReader(r io.Reader, expected [Size]byte) (bool, error) {
+	sum, err := sumReader(r)
+	if err != nil {
+		return false, &ReadError{Err: err}
+	}
+	return verify(sum, expected), nil
+}
+
+// VerifyManifest returns true if the given block hashes (e.g. from ReadManifest) combine to the expected
+// identifier, which shows that a blob reassembled from those blocks has it without needing any of its data.
+// As for Verify, the comparison is done in constant time; combining the hashes is linear in their number.
+func VerifyManifest(expected [Size]byte, blockHashes [][sha256.Size]byte) bool {
+	return verify(CombineBlockHashes(blockHashes), expected)
+}
+
+func verify(sum, expected [Size]byte) bool {
+	return subtle.ConstantTimeCompare(sum[:], expected[:]) == 1
+}
+
+// NewVerifyingReader returns a reader that reads from r, hashing the data as it goes. Once r reaches EOF,
+// it returns ErrHashMismatch instead of io.EOF if the hash of everything read isn't the expected one.
+// Other errors from r are returned unchanged.
+// Closing it releases the hash (which is otherwise done once Read returns an error), and closes r if
+// it's an io.Closer; callers that might not read it to EOF should do so.
+func NewVerifyingReader(r io.Reader, expected [Size]byte) io.ReadCloser {
+	return &verifyingReader{r: r, h: New().(*vsoHash), expected: expected}
+}
+
+// NewBlockVerifyingReader is like NewVerifyingReader, but also checks the hash of each block against
+// the given ones as soon as it's been read, so a mismatch is reported without waiting for the rest of
+// the input. In that case Read returns a *BlockMismatchError; it may be returned along with some of
+// that block's data, which the caller should discard.
+func NewBlockVerifyingReader(r io.Reader, expected [Size]byte, blockHashes [][sha256.Size]byte) io.ReadCloser {
+	return &verifyingReader{r: r, h: New().(*vsoHash), expected: expected, blockHashes: blockHashes, checkBlocks: true}
+}
+
+type verifyingReader struct {
+	r           io.Reader
+	h           *vsoHash
+	expected    [Size]byte
+	blockHashes [][sha256.Size]byte
+	checkBlocks bool
+	// The number of blocks that have been checked so far.
+	checked int
+	// Once set, this is returned from every subsequent Read.
+	err error
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.r.Read(p)
+	r.h.Write(p[:n])
+	if r.checkBlocks {
+		if err := r.checkBlockHashes(r.h.blockHashes); err != nil {
+			return n, r.fail(err)
+		}
+	}
+	if err == io.EOF {
+		if r.checkBlocks {
+			// Now we have the last block, which might be partial (and there mustn't be any more expected).
+			if err := r.checkBlockHashes(r.h.BlockHashes()); err != nil {
+				return n, r.fail(err)
+			} else if r.checked != len(r.blockHashes) {
+				return n, r.fail(&BlockMismatchError{Index: r.checked})
+			}
+		}
+		if !verify(r.h.sum(), r.expected) {
+			return n, r.fail(ErrHashMismatch)
+		}
+		return n, r.fail(io.EOF)
+	} else if err != nil {
+		return n, r.fail(err)
+	}
+	return n, nil
+}
+
+func (r *verifyingReader) Close() error {
+	r.h.Close()
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// checkBlockHashes checks any of the given hashes that haven't been already.
+func (r *verifyingReader) checkBlockHashes(hashes [][sha256.Size]byte) error {
+	for ; r.checked < len(hashes); r.checked++ {
+		if r.checked >= len(r.blockHashes) || !verifyBlock(hashes[r.checked], r.blockHashes[r.checked]) {
+			return &BlockMismatchError{Index: r.checked}
+		}
+	}
+	return nil
+}
+
+// fail records an error to return from every future read, and releases the hash since it's no longer needed.
+func (r *verifyingReader) fail(err error) error {
+	r.err = err
+	r.h.Close()
+	return err
+}
+
+func verifyBlock(hash, expected [sha256.Size]byte) bool {
+	return subtle.ConstantTimeCompare(hash[:], expected[:]) == 1
+}
+
+// VerifyBlocks checks that the blocks of everything read from r until EOF have the given hashes (for example,
+// from a manifest written by an earlier BlockHashes). It returns -1 and nil if they all do, or the index of the
+// first block that doesn't and a *BlockMismatchError. Having more or fewer blocks than expected counts as a
+// mismatch of the first block that's extra or missing.
+// If reading fails, it returns -1 and a *ReadError.
+func VerifyBlocks(r io.Reader, expected [][sha256.Size]byte) (int, error) {
+	// The overall hash can't differ if every block matches, since it's derived from the same hashes.
+	_, err := io.Copy(io.Discard, NewBlockVerifyingReader(r, CombineBlockHashes(expected), expected))
+	var mismatch *BlockMismatchError
+	if err == nil {
+		return -1, nil
+	} else if errors.As(err, &mismatch) {
+		return mismatch.Index, err
+	}
+	return -1, &ReadError{Err: err}
+}
@@ -0,0 +1,163 @@
+package vsohash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	in := sequentialInput(BlockSize + 1)
+	sum := Sum(in)
+	assert.True(t, Verify(in, sum))
+	assert.False(t, Verify(in[1:], sum))
+	sum[Size-1] = 1
+	assert.False(t, Verify(in, sum))
+}
+
+func TestVerifyManifest(t *testing.T) {
+	in := sequentialInput(3*BlockSize + 5)
+	hashes := blockHashesOf(in)
+	assert.True(t, VerifyManifest(Sum(in), hashes))
+	assert.False(t, VerifyManifest(Sum(in), hashes[:3]))
+	assert.False(t, VerifyManifest(Sum(in), [][sha256.Size]byte{hashes[3], hashes[1], hashes[2], hashes[0]}))
+	assert.True(t, VerifyManifest(Sum(nil), nil))
+}
+
+func TestVerifyReader(t *testing.T) {
+	in := sequentialInput(2*BlockSize + PageSize)
+	ok, err := VerifyReader(bytes.NewReader(in), Sum(in))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = VerifyReader(bytes.NewReader(in[:BlockSize]), Sum(in))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestVerifyReaderError(t *testing.T) {
+	kaboom := errors.New("kaboom")
+	r := io.MultiReader(bytes.NewReader([]byte("header")), &errorReader{err: kaboom})
+	ok, err := VerifyReader(r, Sum([]byte("header")))
+	assert.False(t, ok)
+	var readErr *ReadError
+	require.ErrorAs(t, err, &readErr)
+	assert.ErrorIs(t, err, kaboom)
+}
+
+func TestVerifyingReaderClose(t *testing.T) {
+	in := sequentialInput(BlockSize + 10)
+	for _, r := range []io.ReadCloser{
+		NewVerifyingReader(&closeRecorder{Reader: bytes.NewReader(in)}, Sum(in)),
+		NewBlockVerifyingReader(&closeRecorder{Reader: bytes.NewReader(in)}, Sum(in), blockHashesOf(in)),
+	} {
+		_, err := io.ReadFull(r, make([]byte, PageSize))
+		require.NoError(t, err)
+		assert.NoError(t, r.Close())
+		assert.True(t, r.(*verifyingReader).h.closed)
+		assert.True(t, r.(*verifyingReader).r.(*closeRecorder).closed)
+	}
+}
+
+func TestVerifyingReader(t *testing.T) {
+	in := sequentialInput(2*BlockSize + PageSize)
+	out, err := io.ReadAll(NewVerifyingReader(bytes.NewReader(in), Sum(in)))
+	assert.NoError(t, err)
+	assert.Equal(t, in, out)
+}
+
+func TestVerifyingReaderMismatch(t *testing.T) {
+	in := sequentialInput(2*BlockSize + PageSize)
+	_, err := io.ReadAll(NewVerifyingReader(bytes.NewReader(in[1:]), Sum(in)))
+	assert.Equal(t, ErrHashMismatch, err)
+}
+
+func TestVerifyingReaderError(t *testing.T) {
+	kaboom := errors.New("kaboom")
+	r := NewVerifyingReader(io.MultiReader(bytes.NewReader([]byte("header")), &errorReader{err: kaboom}), Sum([]byte("header")))
+	_, err := io.ReadAll(r)
+	assert.Equal(t, kaboom, err)
+}
+
+func TestBlockVerifyingReader(t *testing.T) {
+	in := sequentialInput(2*BlockSize + PageSize)
+	out, err := io.ReadAll(NewBlockVerifyingReader(bytes.NewReader(in), Sum(in), blockHashesOf(in)))
+	assert.NoError(t, err)
+	assert.Equal(t, in, out)
+}
+
+func TestBlockVerifyingReaderMismatch(t *testing.T) {
+	in := sequentialInput(3*BlockSize + PageSize)
+	corrupted := append([]byte{}, in...)
+	corrupted[BlockSize+5] ^= 0xff
+	r := NewBlockVerifyingReader(bytes.NewReader(corrupted), Sum(in), blockHashesOf(in))
+	buf := make([]byte, PageSize)
+	read := 0
+	var err error
+	for err == nil {
+		var n int
+		n, err = r.Read(buf)
+		read += n
+	}
+	var mismatch *BlockMismatchError
+	require.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, 1, mismatch.Index)
+	assert.ErrorIs(t, err, ErrHashMismatch)
+	// It should be noticed as soon as that block is finished.
+	assert.Equal(t, 2*BlockSize, read)
+	_, err = r.Read(buf)
+	assert.Equal(t, mismatch, err)
+}
+
+func TestBlockVerifyingReaderTooShort(t *testing.T) {
+	in := sequentialInput(2*BlockSize + PageSize)
+	r := NewBlockVerifyingReader(bytes.NewReader(in[:BlockSize]), Sum(in), blockHashesOf(in))
+	_, err := io.ReadAll(r)
+	var mismatch *BlockMismatchError
+	require.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, 1, mismatch.Index)
+}
+
+func TestVerifyBlocks(t *testing.T) {
+	for _, lim := range []int{0, 1, BlockSize, BlockSize + 1, 3*BlockSize + 17} {
+		in := sequentialInput(lim)
+		idx, err := VerifyBlocks(bytes.NewReader(in), blockHashesOf(in))
+		assert.NoError(t, err)
+		assert.Equal(t, -1, idx)
+	}
+}
+
+func TestVerifyBlocksMismatch(t *testing.T) {
+	in := sequentialInput(3*BlockSize + 17)
+	expected := blockHashesOf(in)
+	corrupted := append([]byte{}, in...)
+	corrupted[2*BlockSize] ^= 1
+	idx, err := VerifyBlocks(bytes.NewReader(corrupted), expected)
+	assert.Equal(t, 2, idx)
+	assert.ErrorIs(t, err, ErrHashMismatch)
+	// A short final block
+	idx, err = VerifyBlocks(bytes.NewReader(in[:len(in)-1]), expected)
+	assert.Equal(t, 3, idx)
+	assert.ErrorIs(t, err, ErrHashMismatch)
+	// Missing blocks
+	idx, err = VerifyBlocks(bytes.NewReader(in[:2*BlockSize]), expected)
+	assert.Equal(t, 2, idx)
+	assert.ErrorIs(t, err, ErrHashMismatch)
+	// Extra blocks
+	idx, err = VerifyBlocks(bytes.NewReader(in), expected[:2])
+	assert.Equal(t, 2, idx)
+	assert.ErrorIs(t, err, ErrHashMismatch)
+}
+
+func TestVerifyBlocksReadError(t *testing.T) {
+	kaboom := errors.New("kaboom")
+	idx, err := VerifyBlocks(io.MultiReader(bytes.NewReader([]byte("header")), &errorReader{err: kaboom}), nil)
+	assert.Equal(t, -1, idx)
+	var readErr *ReadError
+	require.ErrorAs(t, err, &readErr)
+	assert.ErrorIs(t, err, kaboom)
+}
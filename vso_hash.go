@@ -7,9 +7,17 @@ package vsohash
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"encoding"
+	"errors"
+	"fmt"
 	"hash"
+	"io"
 	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 )
 
 // Size is the number of bytes of the output hash.
@@ -21,187 +29,1264 @@ const BlockSize = 2 * 1024 * 1024
 // PageSize is the size of the pages within each block. They're always 64kb
 const PageSize = 64 * 1024
 
-const pagesPerBlock = BlockSize / PageSize
+// PagesPerBlock is the number of pages in each block. Only the last block of an input can have fewer.
+const PagesPerBlock = BlockSize / PageSize
 
 const seed = "VSO Content Identifier Seed"
 
-// New returns a new hash. It will perform up to GOMAXPROCS calculations in parallel.
-//
-// Note that the returned hash does not fully faithfully implement the semantics of Sum(); it does update
-// the underlying state (it's quite difficult to implement Go's semantics here).
-// After calling Sum, the caller should not call other functions on the hash object.
-func New() hash.Hash {
-	return NewParallel(runtime.GOMAXPROCS(0))
+// ErrEmptyInput is returned when finalising a hash created WithRejectEmpty that has had nothing written to it.
+var ErrEmptyInput = errors.New("vsohash: input is empty")
+
+// ErrClosed is returned when writing to a hash that has been closed.
+var ErrClosed = errors.New("vsohash: write to closed hash")
+
+// ErrPoolClosed is returned when using a hash whose Pool has been closed.
+var ErrPoolClosed = errors.New("vsohash: pool has been closed")
+
+// A BlockAlignmentError is returned when finalising a hash created WithRequireBlockAlignment whose input
+// isn't a whole number of blocks.
+type BlockAlignmentError struct {
+	// The size of the input
+	Size int64
+}
+
+func (err *BlockAlignmentError) Error() string {
+	return fmt.Sprintf("vsohash: input size %d is not a multiple of the block size %d; the nearest valid size is %d", err.Size, BlockSize, err.Nearest())
+}
+
+// A PanicError is returned from Write and SumErr if hashing a page in the background panicked.
+// Once that's happened the hash can't be used again until it's Reset.
+type PanicError struct {
+	// The value the panic was called with
+	Value interface{}
+	// The stack of the goroutine that panicked
+	Stack []byte
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("vsohash: panic while hashing: %v\n%s", err.Value, err.Stack)
+}
+
+// Nearest returns the closest size to the input's that is a whole number of blocks (rounding up if it's halfway).
+func (err *BlockAlignmentError) Nearest() int64 {
+	lower := err.Size / BlockSize * BlockSize
+	if err.Size-lower < BlockSize/2 {
+		return lower
+	}
+	return lower + BlockSize
+}
+
+// A Hasher is a VSO-Hash. It extends hash.Hash with some extra functionality; New and NewParallel
+// return hash.Hash (so they can be used anywhere the standard library ones are) but the returned
+// values can always be asserted to a Hasher.
+type Hasher interface {
+	hash.Hash
+	// Close releases the hash's background goroutines. See Close below for more details.
+	io.Closer
+	// ReadFrom writes everything read from a reader to the hash, more efficiently than io.Copy would
+	// otherwise do (see ReadFrom below).
+	io.ReaderFrom
+	// WriteString is like Write, but avoids converting a string to a byte slice first.
+	io.StringWriter
+	// WriteByte writes a single byte, much more cheaply than Write would for one (see WriteByte below).
+	io.ByteWriter
+	// WriteZeros writes a number of zero bytes, more quickly than writing them would (see WriteZeros below).
+	WriteZeros(n int64) (int64, error)
+	// SumInto is like Sum but writes the hash into an array (see SumInto below).
+	SumInto(dst *[Size]byte)
+	// SumErr finalises the hash and returns it. It returns an error if the hash can't be calculated,
+	// for example if the options it was created with don't permit the input it has been given.
+	// Sum panics with the same error in those cases (other than a cancelled context; see SumErr below).
+	SumErr() ([Size]byte, error)
+	// BlockHashes returns the hashes of each block so far (see BlockHashes below).
+	BlockHashes() [][sha256.Size]byte
+	// WriteManifest writes the hashes of each block to a writer (see WriteManifest below).
+	WriteManifest(w io.Writer) error
+	// Blocks returns information about each block so far, including its hash (see Blocks below).
+	Blocks() []BlockInfo
+	// MerkleRoot returns the root of the Merkle tree over the block hashes (see WithMerkleTree).
+	MerkleRoot() ([sha256.Size]byte, error)
+	// BlockProof returns the Merkle inclusion proof for a single block (see WithMerkleTree).
+	BlockProof(index int) ([][sha256.Size]byte, error)
+	// Clone returns an independent copy of the hash in its current state (see Clone below).
+	Clone() hash.Hash
+	// The hash's state can be saved and restored, as for the standard library's hashes (see MarshalBinary below).
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+	// BytesWritten returns the total number of bytes written so far.
+	BytesWritten() int64
+	// Stats returns statistics about what the hash has done so far.
+	Stats() Stats
+	// Checkpoint is like MarshalBinary but only captures the state as of the last block boundary (see Checkpoint below).
+	Checkpoint() ([]byte, error)
+	// ResetParallel is like Reset but also changes the hash's parallelism (see ResetParallel below).
+	ResetParallel(parallelism int)
+}
+
+var _ Hasher = (*vsoHash)(nil)
+
+// maxDigestSize is the largest inner hash we support for paged hashes (which is enough for SHA-512).
+const maxDigestSize = 64
+
+// A digest is the hash of a single page. Only the first Size() bytes of the inner hash are used.
+type digest [maxDigestSize]byte
+
+// New returns a new hash. It will perform up to GOMAXPROCS calculations in parallel, unless WithParallelism
+// says otherwise. Any options given are applied to the new hash.
+func New(opts ...Option) hash.Hash {
+	return NewParallel(runtime.GOMAXPROCS(0), opts...)
+}
+
+// NewAuto returns a new hash whose parallelism is chosen based on the expected size of its input.
+// It never uses more than GOMAXPROCS workers, nor more than could ever be busy for an input of that
+// size (only one page at a time for inputs up to a page, no more than PagesPerBlock at once for
+// larger ones); if only one would be used it's sequential (see NewSequential).
+// sizeHint is only a hint; writing more or less than it doesn't affect the result.
+// If it's negative the size is assumed to be unknown, which gives the same as New.
+func NewAuto(sizeHint int, opts ...Option) hash.Hash {
+	if sizeHint < 0 {
+		return New(opts...)
+	}
+	parallelism := runtime.GOMAXPROCS(0)
+	if pages := divRoundUp(int64(sizeHint), PageSize); pages < int64(parallelism) {
+		parallelism = int(pages)
+	}
+	if parallelism > PagesPerBlock {
+		parallelism = PagesPerBlock
+	}
+	if parallelism <= 1 {
+		return NewSequential(opts...)
+	}
+	return NewParallel(parallelism, opts...)
 }
 
 // NewParallel returns a new hash. It will perform up to the given number of calculations in parallel.
+// It never starts more than PagesPerBlock workers however large parallelism is (see setParallelism).
+//
+// The hash's background goroutines are released by Close, or when it's garbage collected; the returned
+// value always implements io.Closer (and Hasher) so callers can do `defer h.(io.Closer).Close()`.
+func NewParallel(parallelism int, opts ...Option) hash.Hash {
+	return newHash(newSHA256, BlockSize, PageSize, parallelism, []byte{0}, opts)
+}
+
+// NewSequential returns a new hash that does all its calculations inline in Write (and Sum), without
+// any background goroutines. This is useful for callers that are already parallel themselves, or that
+// are hashing small inputs where the overhead of the workers isn't worthwhile.
+// There's nothing for Close to release, although the hash still can't be written to afterwards.
+func NewSequential(opts ...Option) hash.Hash {
+	return newUnstartedHash(newSHA256, BlockSize, PageSize, []byte{0}, opts)
+}
+
+// NewParallelSem is like NewParallel, but the hash's workers must acquire from the given semaphore
+// while they're calculating a page hash. This lets many hashes share a process-wide concurrency limit,
+// so they can't collectively starve other work.
+//
+// The semaphore is a buffered channel; its capacity is the total budget and a slot is acquired by
+// sending to it (and released by receiving from it). Slots are only held for the duration of a single
+// page, so nothing needs to be released when the hash is done with.
+func NewParallelSem(parallelism int, sem chan struct{}, opts ...Option) hash.Hash {
+	return newHash(newSHA256, BlockSize, PageSize, parallelism, []byte{0}, append([]Option{func(o *options) {
+		o.sem = sem
+	}}, opts...))
+}
+
+// NewWithContext is like NewParallel, but the hash's lifetime is tied to the given context.
+// Once ctx is cancelled the hash's workers exit, and any further calls to Write return ctx.Err().
+// This is useful to stop hashing a large stream when whoever asked for it has gone away.
 //
-// Note that the returned hash does not faithfully implement the semantics of Sum(); it does update
-// the underlying state (it's quite difficult to implement Go's semantics here).
-// After calling Sum, the caller should not call other functions on the hash object.
-func NewParallel(parallelism int) hash.Hash {
+// The result of Sum on a hash whose context has been cancelled is undefined (it will generally be
+// based on some unspecified part of the input), so callers should check ctx.Err() before using it,
+// or use SumErr, which returns it.
+func NewWithContext(ctx context.Context, parallelism int, opts ...Option) hash.Hash {
+	return newHash(newSHA256, BlockSize, PageSize, parallelism, []byte{0}, append([]Option{withContext(ctx)}, opts...))
+}
+
+// newHash returns a new paged hash with the given structure, with its own set of workers.
+// The suffix is appended to the final hash; for VSO-Hash it's the algorithm identifier byte.
+// The workers aren't started until there are pages for them (see startWorker).
+// With a parallelism of 1 there's no point handing pages off to a single worker, so they're hashed
+// inline instead (unless there's a semaphore, which that worker would need to respect).
+func newHash(newInner func() hash.Hash, blockSize, pageSize, parallelism int, suffix []byte, opts []Option) *vsoHash {
 	if parallelism <= 0 {
 		panic("Parallelism must be strictly positive")
 	}
+	v := newUnstartedHash(newInner, blockSize, pageSize, suffix, opts)
+	if v.opts.parallelism > 0 {
+		parallelism = v.opts.parallelism
+	}
+	if v.opts.hasExpectedSize {
+		if pages := divRoundUp(v.opts.expectedSize, int64(v.pageSize)); pages < int64(parallelism) {
+			parallelism = int(pages)
+			if parallelism == 0 {
+				parallelism = 1
+			}
+		}
+	}
+	v.setParallelism(parallelism)
+	return v
+}
+
+// setParallelism sets up the hash to use the given number of workers (without starting them yet).
+// It mustn't have any already.
+//
+// The number of workers is capped at the number of pages in a block (or WithMaxInFlightPages, if that's
+// lower). Blocks are chained one after another, so beyond a block's worth of pages the extra workers spend
+// most of their time waiting for the next block to start, and just add scheduling overhead. Paged hashes
+// with only a few pages per block are the ones this limits most.
+func (v *vsoHash) setParallelism(parallelism int) {
+	if limit := v.maxWorkers(); parallelism > limit {
+		parallelism = limit
+	}
+	if parallelism == 1 && v.opts.sem == nil {
+		return
+	}
+	v.tasks = make(chan hashTask, parallelism)
+	v.running = &sync.WaitGroup{}
+	if v.opts.affinity {
+		v.workers = make([]chan hashTask, parallelism)
+		for i := range v.workers {
+			v.workers[i] = make(chan hashTask, 1)
+		}
+	}
+	if !v.opts.noFinalizer {
+		runtime.SetFinalizer(v, finalize)
+	}
+}
+
+// maxWorkers returns the most workers that are worth starting (see setParallelism).
+func (v *vsoHash) maxWorkers() int {
+	if v.opts.maxInFlight > 0 && v.opts.maxInFlight < v.pagesPerBlock {
+		return v.opts.maxInFlight
+	}
+	return v.pagesPerBlock
+}
+
+// startWorker starts a worker goroutine reading from the given task queue.
+func (v *vsoHash) startWorker(tasks chan hashTask) {
+	v.started++
+	v.running.Add(1)
+	go run(tasks, v.newInner, v.opts.sem, v.opts.done(), v.running)
+}
+
+// newUnstartedHash returns a new paged hash with the given structure, but without any workers;
+// the caller must arrange for something to process its tasks. If it doesn't set any up, pages are
+// hashed inline as they're written.
+func newUnstartedHash(newInner func() hash.Hash, blockSize, pageSize int, suffix []byte, opts []Option) *vsoHash {
+	inner := newInner()
+	if inner.Size() > maxDigestSize {
+		panic("Inner hash is too large")
+	}
 	v := &vsoHash{
-		tasks:      make(chan hashTask, parallelism),
-		pageHashes: make([]<-chan [sha256.Size]byte, 0, pagesPerBlock),
+		pageSize:      pageSize,
+		pagesPerBlock: blockSize / pageSize,
+		newInner:      newInner,
+		inner:         inner,
+		suffix:        suffix,
+		current:       newPageBlock(blockSize / pageSize),
+	}
+	v.opts.buffers = pagePool
+	for _, opt := range opts {
+		opt(&v.opts)
+	}
+	if v.opts.customSeed && suffix != nil {
+		panic("WithSeed can only be used with paged hashes")
+	} else if v.opts.cache != nil && (pageSize != PageSize || blockSize != BlockSize || inner.Size() != sha256.Size) {
+		// Cached blocks are always hashed as standard VSO-Hash blocks (and the cache can't tell one structure from another).
+		panic("WithBlockCache can only be used with the standard VSO-Hash page & block sizes")
 	}
-	v.buffer.Grow(PageSize)
-	v.blobID.Grow(2*Size + 1)
-	for i := 0; i < parallelism; i++ {
-		go v.run()
+	if v.opts.selfCheck {
+		// This only needs the options that affect the result; notably not WithBlockCache, since that's
+		// one of the things being checked.
+		seed, customSeed := v.opts.seed, v.opts.customSeed
+		v.shadow = newUnstartedHash(newInner, blockSize, pageSize, suffix, []Option{func(o *options) {
+			o.seed, o.customSeed = seed, customSeed
+		}})
 	}
-	runtime.SetFinalizer(v, finalize)
+	if v.opts.cache != nil {
+		v.block = make([]byte, 0, blockSize)
+	}
+	if v.opts.maxInFlight > 0 {
+		v.inFlight = make(chan struct{}, v.opts.maxInFlight)
+	}
+	if v.opts.hasExpectedSize && inner.Size() == sha256.Size {
+		// The size is only a hint, so a wildly wrong one mustn't allocate a huge amount up front.
+		blocks := divRoundUp(v.opts.expectedSize, int64(blockSize))
+		if blocks > maxPreallocatedBlocks {
+			blocks = maxPreallocatedBlocks
+		}
+		v.blockHashes = make([][sha256.Size]byte, 0, blocks)
+	}
+	v.buffer.Grow(pageSize)
+	// The blob id is always the previous one's hash (or the seed) followed by a block hash, so its
+	// buffer never needs to grow past this.
+	blobID := 2 * inner.Size()
+	if n := len(v.opts.blobIDSeed()) + inner.Size(); n > blobID {
+		blobID = n
+	}
+	v.blobID.Grow(blobID)
 	return v
 }
 
 type vsoHash struct {
+	// The options this hash was created with. These, the structure and the workers below are
+	// preserved by Reset; everything after that is state that Reset must clear.
+	opts options
+	// The structure of the hash; for VSO-Hash these are always PageSize & PagesPerBlock.
+	pageSize, pagesPerBlock int
+	// Constructs new instances of the inner hash (for VSO-Hash this is always SHA256)
+	newInner func() hash.Hash
+	// An instance of the inner hash used for the block & blob id calculations
+	inner hash.Hash
+	// Suffix that's appended to the final hash
+	suffix []byte
+	// The set of waiting hash tasks
+	tasks chan hashTask
+	// Per-worker task queues; only used with WithAffinity, in which case tasks is unused.
+	workers []chan hashTask
+	// Limits the number of pages waiting to be hashed; only used WithMaxInFlightPages.
+	inFlight chan struct{}
+	// Tracks the running worker goroutines. This is nil if the workers don't belong to this hash.
+	running *sync.WaitGroup
+	// The number of workers that have been started so far. They're started as pages are dispatched,
+	// up to cap(tasks), so a hash that's only given a little input doesn't start more than it needs.
+	started int
+	// True once Close has been called
+	closed bool
+	// Set if hashing any page panicked (see PanicError)
+	err error
+	// The pool the hash was created from, if it was
+	pool *Pool
+	// A sequential hash that's given the same input, to check the result against (see WithSelfCheck)
+	shadow *vsoHash
+
 	// The running buffer of the current page
 	buffer bytes.Buffer
-	// The calculations of the current set of page hashes
-	pageHashes []<-chan [sha256.Size]byte
+	// The pages of the current block
+	current *pageBlock
+	// Blocks that have been finished but not yet added to the blob id, in order.
+	pendingBlocks []*pageBlock
 	// The current blob id (updated as we run through the hash)
 	blobID bytes.Buffer
-	// The set of waiting hash tasks
-	tasks chan hashTask
+	// The number of blocks that have been added to the blob id
+	blocks int
+	// The total number of bytes written
+	written int64
+	// The hashes of each block so far (only recorded if the inner hash is the same size as SHA256)
+	blockHashes [][sha256.Size]byte
+	// The current block; only used when we have a block cache, in which case we can't
+	// dispatch any pages until we know the block isn't already cached.
+	block []byte
+	// The last total passed to the progress function (see WithProgress)
+	reported int64
+	// The number of pages that have been dispatched to be hashed
+	pages int64
+	// Scratch space for calculating sums. Anything passed to the inner hash escapes, so this saves
+	// allocating it each time.
+	scratch struct {
+		last, block digest
+		next        [2 * maxDigestSize]byte
+	}
 }
 
+// A hashTask is a single page for one of the workers to hash.
 type hashTask struct {
-	Input  []byte
-	Output chan [sha256.Size]byte
+	Input []byte
+	// The block the page belongs to, and its index within it.
+	Block *pageBlock
+	Index int
+	// If set, this is returned to Pool once the input has been hashed.
+	Release *[PageSize]byte
+	Pool    BufferPool
+	// If set, a slot is released from this once the input has been hashed.
+	InFlight chan struct{}
+}
+
+// maxPreallocatedBlocks is the most block hashes that WithExpectedSize will allocate space for up front
+// (enough for 8GB of input); past that they're appended as usual.
+const maxPreallocatedBlocks = 4096
+
+// maxPendingBlocks is the maximum number of blocks that can be waiting to be added to the blob id.
+// Past this, Write waits for the oldest before starting on any more.
+const maxPendingBlocks = 4
+
+// A pageBlock collects the hashes of the pages in a block as the workers calculate them.
+// Once the block is finished and all its pages are done, whoever finishes last calculates the block's
+// hash (so that's done in parallel as well, rather than holding up Write).
+type pageBlock struct {
+	// The hash of each page, filled in by the workers.
+	pages []digest
+	// The number of pages that have been dispatched. This is only used by the hash itself.
+	n int
+	// The number of pages still being hashed, plus one until the block is finished. Whoever brings
+	// this to zero calculates sum and signals done.
+	remaining int32
+	sum       digest
+	done      chan struct{}
+	// Set if hashing any of the pages (or the block itself) panicked. It's only safe to read once done
+	// has been signalled.
+	mutex sync.Mutex
+	err   error
+}
+
+// blockPool holds pageBlocks that have been waited for, so nothing else refers to them any more.
+var blockPool sync.Pool
+
+func newPageBlock(pagesPerBlock int) *pageBlock {
+	if b, ok := blockPool.Get().(*pageBlock); ok && len(b.pages) == pagesPerBlock {
+		b.n = 0
+		b.remaining = 1
+		b.err = nil
+		return b
+	}
+	return &pageBlock{
+		pages:     make([]digest, pagesPerBlock),
+		remaining: 1,
+		done:      make(chan struct{}, 1),
+	}
+}
+
+// release releases one reference to the block (either a page that's been hashed, or the block being finished).
+// If that was the last one it calculates the block's hash using h.
+func (b *pageBlock) release(h hash.Hash) {
+	if atomic.AddInt32(&b.remaining, -1) != 0 {
+		return
+	}
+	if err := b.hash(h); err != nil {
+		b.fail(err)
+	}
+	b.done <- struct{}{}
+}
+
+// hash calculates the block's hash from its pages. It returns an error if that panics.
+func (b *pageBlock) hash(h hash.Hash) (err error) {
+	defer recoverPanic(&err)
+	size := h.Size()
+	h.Reset()
+	for i := range b.pages[:b.n] {
+		h.Write(b.pages[i][:size])
+	}
+	h.Sum(b.sum[:0])
+	return nil
+}
+
+// fail records that hashing some of the block failed. Only the first error is kept.
+func (b *pageBlock) fail(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// recoverPanic recovers from a panic, if there is one, and sets err to a PanicError describing it.
+// It must be deferred directly.
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r, Stack: debug.Stack()}
+	}
+}
+
+// wait waits for the block to be done. It must only be called once, after which the block can be
+// reused if it returned true. It returns false if the given channel is closed first.
+func (b *pageBlock) wait(cancelled <-chan struct{}) bool {
+	select {
+	case <-b.done:
+		return true
+	case <-cancelled:
+		return false
+	}
+}
+
+// pagePool holds buffers for pages that have to be copied out of the hash's buffer.
+// It's used unless the hash was given a different one (see WithBufferPool).
+var pagePool BufferPool = &syncBufferPool{
+	pool: sync.Pool{
+		New: func() interface{} {
+			return new([PageSize]byte)
+		},
+	},
+}
+
+// A syncBufferPool is a BufferPool backed by a sync.Pool.
+type syncBufferPool struct {
+	pool sync.Pool
+}
+
+func (p *syncBufferPool) Get() *[PageSize]byte {
+	return p.pool.Get().(*[PageSize]byte)
+}
+
+func (p *syncBufferPool) Put(b *[PageSize]byte) {
+	p.pool.Put(b)
+}
+
+// Close releases the background goroutines used by the hash, and waits for them to exit. It should be
+// called once the hash is no longer needed (i.e. after Sum has been called); the hash can't be written
+// to again afterwards (Write returns ErrClosed), although Sum still works.
+// If it isn't called, they'll be released when the hash is garbage collected, but that may not
+// happen until some time later.
+// It's safe to call Close more than once; it always returns nil.
+func (v *vsoHash) Close() error {
+	if !v.closed {
+		v.closed = true
+		if v.running != nil { // Hashes from a pool don't own their workers.
+			runtime.SetFinalizer(v, nil)
+			finalize(v)
+			v.running.Wait()
+		}
+	}
+	return nil
 }
 
 // finalize is a GC finalizer function that is run when this hash is collected.
 // It closes the internal task channel which permits the background goroutines to exit.
 func finalize(v *vsoHash) {
 	close(v.tasks)
+	for _, w := range v.workers {
+		close(w)
+	}
 }
 
-func (v *vsoHash) run() {
-	for task := range v.tasks {
-		task.Output <- sha256.Sum256(task.Input)
+// run is the loop run by each worker goroutine, hashing pages until the task channel is closed
+// or done is (done may be nil, in which case only the task channel matters).
+// Note that it mustn't reference the hash itself, otherwise it would never become unreachable and
+// the finalizer would never run.
+func run(tasks <-chan hashTask, newInner func() hash.Hash, sem chan struct{}, done <-chan struct{}, running *sync.WaitGroup) {
+	defer running.Done()
+	h := newInner()
+	for {
+		var task hashTask
+		select {
+		case t, ok := <-tasks:
+			if !ok {
+				return
+			}
+			task = t
+		case <-done:
+			return
+		}
+		if sem != nil {
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				return
+			}
+		}
+		hashPage(h, task)
+		if sem != nil {
+			<-sem
+		}
 	}
 }
 
+// hashPage hashes a single page using the given hash and records it in its block.
+// If that panics, the panic is recorded on the block rather than taking down the whole process.
+func hashPage(h hash.Hash, task hashTask) {
+	if err := hashInput(h, &task); err != nil {
+		task.Block.fail(err)
+	}
+	if task.Release != nil {
+		// We've finished with the input now so it's safe for it to be reused.
+		task.Pool.Put(task.Release)
+	}
+	if task.InFlight != nil {
+		<-task.InFlight
+	}
+	task.Block.release(h)
+}
+
+// hashInput hashes a task's input into its page of the block, returning an error if that panics.
+func hashInput(h hash.Hash, task *hashTask) (err error) {
+	defer recoverPanic(&err)
+	h.Reset()
+	h.Write(task.Input)
+	h.Sum(task.Block.pages[task.Index][:0])
+	return nil
+}
+
+// Write implements io.Writer. However large in is, the amount of work outstanding at once is bounded:
+// pages are hashed directly from in without being copied, and once maxPendingBlocks blocks are waiting
+// to be resolved Write waits for the oldest before dispatching any more (or sooner, WithMaxInFlightPages).
+// Any pages that refer to in are finished with before it returns, so the caller can reuse it afterwards.
 func (v *vsoHash) Write(in []byte) (int, error) {
+	n, err := v.write(in)
+	if v.shadow != nil {
+		v.shadow.Write(in[:n])
+	}
+	return n, err
+}
+
+// write is the implementation of Write (without feeding anything to the self-check hash).
+func (v *vsoHash) write(in []byte) (int, error) {
+	if err := v.writable(); err != nil {
+		return 0, err
+	}
+	v.written += int64(len(in))
+	if v.opts.cache != nil {
+		return v.writeCached(in)
+	}
+	// Pages that are still being hashed may refer to in, which the caller is free to change as soon
+	// as we return, so they have to be finished by then. Pages that were copied don't, so if that's
+	// all we wrote there's no need to wait for anything (which keeps small writes pipelined), unless
+	// someone's waiting to hear about finished blocks.
+	// These are the indices of the first & last blocks that direct pages went into; blocks are recycled,
+	// so they can't be told apart by pointer. Once a block's failed the indices stop advancing (see
+	// updateBlobID), so then we just wait for everything.
+	first, last := -1, -1
+	defer func() {
+		direct := first != -1
+		if direct && (first < v.currentBlock() || v.err != nil) || v.opts.reportsBlocks() {
+			// Blocks are resolved in order, so this may also wait for earlier ones.
+			v.resolveBlocks()
+		}
+		if direct && (last == v.currentBlock() || v.err != nil) {
+			v.peekPages()
+		}
+	}()
+	n := len(in)
 	// Write one page at a time
 	for {
+		if err := v.interrupted(len(in)); err != nil {
+			return n - len(in), err
+		}
 		// If this data fits within the buffer and doesn't finish a page, just keep it for later.
-		if len(in)+v.buffer.Len() < PageSize {
+		if len(in)+v.buffer.Len() < v.pageSize {
 			v.buffer.Write(in)
-			return len(in), nil
+			return n, nil
 		}
 		// If we've got some data written already, take it into account.
 		// From above we know that we will finish at least one page here.
 		if v.buffer.Len() > 0 {
-			n := PageSize - v.buffer.Len()
+			n := v.pageSize - v.buffer.Len()
 			v.buffer.Write(in[:n])
 			in = in[n:]
 			// We must copy the contents of the buffer since we'll keep it around asynchronously.
-			// TODO(peterebden): maybe pool these objects?
-			b := [PageSize]byte{}
-			copy(b[:], v.buffer.Bytes())
-			v.writePage(b[:])
+			if v.pageSize == PageSize {
+				b := v.opts.buffers.Get()
+				copy(b[:], v.buffer.Bytes())
+				v.writePooledPage(b)
+			} else {
+				b := make([]byte, v.pageSize)
+				copy(b, v.buffer.Bytes())
+				v.writePage(b)
+			}
 			v.buffer.Reset()
 			continue
 		}
 		// If we get here, there is at least one page size left and nothing in the buffer; write it directly.
-		v.writePage(in[:PageSize])
-		in = in[PageSize:]
+		if first == -1 {
+			first = v.currentBlock()
+		}
+		last = v.currentBlock()
+		v.writePage(in[:v.pageSize])
+		in = in[v.pageSize:]
 	}
 }
 
+// WriteByte implements io.ByteWriter. The byte is added straight to the buffer for the current page,
+// which is only dispatched once it's full, so this is much cheaper than calling Write with one byte;
+// the result is the same either way.
+func (v *vsoHash) WriteByte(c byte) error {
+	if v.opts.cache != nil {
+		_, err := v.Write([]byte{c})
+		return err
+	} else if err := v.writable(); err != nil {
+		return err
+	}
+	v.written++
+	v.buffer.WriteByte(c)
+	if v.shadow != nil {
+		v.shadow.WriteByte(c)
+	}
+	if v.buffer.Len() < v.pageSize {
+		return nil
+	} else if v.pageSize == PageSize {
+		b := v.opts.buffers.Get()
+		copy(b[:], v.buffer.Bytes())
+		v.writePooledPage(b)
+	} else {
+		v.writePage(append([]byte{}, v.buffer.Bytes()...))
+	}
+	v.buffer.Reset()
+	if v.opts.reportsBlocks() {
+		v.resolveBlocks()
+	}
+	return nil
+}
+
+// WriteString is like Write, but for a string. For VSO-Hash it avoids converting the string to a
+// byte slice; each page is copied into a pooled buffer instead.
+func (v *vsoHash) WriteString(s string) (int, error) {
+	if v.opts.cache != nil || v.pageSize != PageSize {
+		return v.Write([]byte(s))
+	}
+	n, err := v.writeString(s)
+	if v.shadow != nil {
+		v.shadow.WriteString(s[:n])
+	}
+	return n, err
+}
+
+// writeString is the implementation of WriteString, as write is for Write.
+func (v *vsoHash) writeString(s string) (int, error) {
+	if err := v.writable(); err != nil {
+		return 0, err
+	}
+	v.written += int64(len(s))
+	// Every page is copied, so unlike Write there's nothing to wait for before returning.
+	if v.opts.reportsBlocks() {
+		defer v.resolveBlocks()
+	}
+	n := len(s)
+	for {
+		if err := v.interrupted(len(s)); err != nil {
+			return n - len(s), err
+		}
+		if len(s)+v.buffer.Len() < PageSize {
+			v.buffer.WriteString(s)
+			return n, nil
+		}
+		b := v.opts.buffers.Get()
+		s = s[copy(b[copy(b[:], v.buffer.Bytes()):], s):]
+		v.buffer.Reset()
+		v.writePooledPage(b)
+	}
+}
+
+// ReadFrom implements io.ReaderFrom, so io.Copy uses it when writing to the hash. It reads directly
+// into page-sized buffers, meaning that whole pages can be dispatched as they are without being copied
+// again (which Write has to do for pages that straddle calls to it, as io.Copy's would).
+// It returns the number of bytes read and any error other than io.EOF.
+func (v *vsoHash) ReadFrom(r io.Reader) (int64, error) {
+	defer v.resolveBlocks()
+	var total int64
+	var unpooled []byte
+	if v.pageSize != PageSize {
+		// This only ever goes through Write, which is finished with it by the time it returns, so it can be reused.
+		unpooled = make([]byte, v.pageSize)
+	}
+	for {
+		var b *[PageSize]byte
+		buf := unpooled
+		if v.pageSize == PageSize {
+			b = v.opts.buffers.Get()
+			buf = b[:]
+		}
+		// Read just enough to finish the current page, so subsequent reads line up with pages.
+		buf = buf[:v.pageSize-v.buffer.Len()]
+		aligned := v.opts.cache == nil && b != nil && len(buf) == PageSize
+		n, err := io.ReadFull(r, buf)
+		total += int64(n)
+		if aligned && n == PageSize {
+			if err := v.writable(); err != nil {
+				v.opts.buffers.Put(b)
+				return total, err
+			}
+			v.written += PageSize
+			if v.shadow != nil {
+				v.shadow.Write(b[:])
+			}
+			v.writePooledPage(b)
+		} else {
+			// If we got the buffer from the pool, anything going through Write here is either part of a page
+			// or being cached, both of which get copied, so it can go back straight away.
+			_, werr := v.Write(buf[:n])
+			if b != nil {
+				v.opts.buffers.Put(b)
+			}
+			if werr != nil {
+				return total, werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return total, nil
+		} else if err != nil {
+			return total, err
+		}
+	}
+}
+
+// writable returns an error if the hash can't currently be written to.
+func (v *vsoHash) writable() error {
+	if v.closed {
+		return ErrClosed
+	} else if v.err != nil {
+		return v.err
+	} else if v.pool != nil && v.pool.isClosed() {
+		return ErrPoolClosed
+	}
+	return v.opts.ctxErr()
+}
+
+// interrupted returns the context's error if it's been cancelled partway through a write, in which case
+// the given number of remaining bytes aren't counted as written (so the length agrees with what we return).
+func (v *vsoHash) interrupted(remaining int) error {
+	err := v.opts.ctxErr()
+	if err != nil {
+		v.written -= int64(remaining)
+	}
+	return err
+}
+
+// currentBlock returns the index of the current block within the input.
+func (v *vsoHash) currentBlock() int {
+	return v.blocks + len(v.pendingBlocks)
+}
+
 // writePage writes one more page to the hash.
 func (v *vsoHash) writePage(page []byte) {
-	ch := make(chan [sha256.Size]byte, 1)
-	v.tasks <- hashTask{Input: page, Output: ch}
-	v.pageHashes = append(v.pageHashes, ch)
+	v.writeTask(hashTask{Input: page})
+}
+
+// writePooledPage is like writePage but the page is returned to the hash's buffer pool once it's been hashed.
+func (v *vsoHash) writePooledPage(page *[PageSize]byte) {
+	v.writeTask(hashTask{Input: page[:], Release: page, Pool: v.opts.buffers})
+}
+
+// writeTask dispatches the given task and finishes the current block if it's now full.
+func (v *vsoHash) writeTask(task hashTask) {
+	v.dispatchPage(task)
+	if v.opts.logger != nil {
+		v.opts.logger("vsohash: dispatched page", "page", v.pages-1, "block", v.blocks+len(v.pendingBlocks), "index", task.Index, "size", len(task.Input))
+	}
 	// Now see if we need to finish a block.
-	if len(v.pageHashes) == pagesPerBlock {
+	if v.current.n == v.pagesPerBlock {
 		v.finishBlock()
 	}
 }
 
-// finishBlock finishes a block and adds it to the current running hash.
+// dispatchPage sends one page off to be hashed in the background.
+func (v *vsoHash) dispatchPage(task hashTask) {
+	if v.inFlight != nil {
+		select {
+		case v.inFlight <- struct{}{}:
+			task.InFlight = v.inFlight
+		case <-v.opts.done():
+		}
+	}
+	task.Block = v.current
+	task.Index = v.current.n
+	v.current.n++
+	v.pages++
+	atomic.AddInt32(&v.current.remaining, 1)
+	v.dispatch(task)
+}
+
+// dispatch sends a task to the workers, or hashes it immediately if the hash doesn't have any.
+// If the hash's context is cancelled the task may be dropped, since there may be no workers left to take it.
+func (v *vsoHash) dispatch(task hashTask) {
+	tasks := v.tasks
+	if tasks == nil {
+		hashPage(v.inner, task)
+		return
+	} else if v.workers != nil {
+		// Pages are assigned to workers by their index in the input.
+		i := ((v.blocks+len(v.pendingBlocks))*v.pagesPerBlock + task.Index) % len(v.workers)
+		tasks = v.workers[i]
+		for v.started <= i {
+			v.startWorker(v.workers[v.started])
+		}
+	} else if v.running != nil && v.started < cap(tasks) {
+		v.startWorker(tasks)
+	}
+	select {
+	case tasks <- task:
+	case <-v.opts.done():
+	}
+}
+
+// finishBlock finishes the current block. Its hash is calculated in the background; the blob id
+// is updated once it's done (see resolveBlocks).
 func (v *vsoHash) finishBlock() {
-	var buf bytes.Buffer
-	buf.Grow(pagesPerBlock * sha256.Size)
-	for _, page := range v.pageHashes {
-		b := <-page
-		buf.Write(b[:])
+	if v.opts.logger != nil {
+		v.opts.logger("vsohash: finished block", "block", v.blocks+len(v.pendingBlocks), "pages", v.current.n)
+	}
+	v.pendingBlocks = append(v.pendingBlocks, v.current)
+	v.current.release(v.inner)
+	v.current = newPageBlock(v.pagesPerBlock)
+	if len(v.pendingBlocks) >= maxPendingBlocks {
+		v.resolveBlock()
+	}
+}
+
+// resolveBlocks waits for all the pending blocks and adds them to the blob id.
+func (v *vsoHash) resolveBlocks() {
+	for len(v.pendingBlocks) > 0 {
+		v.resolveBlock()
 	}
-	v.pageHashes = v.pageHashes[:0]
-	h := sha256.Sum256(buf.Bytes())
-	v.updateBlobID(h[:])
+}
+
+// resolveBlock waits for the oldest pending block and adds it to the blob id.
+func (v *vsoHash) resolveBlock() {
+	blk := v.pendingBlocks[0]
+	v.pendingBlocks = v.pendingBlocks[1:]
+	if v.wait(blk) {
+		v.updateBlobID(blk.sum[:v.inner.Size()])
+		blockPool.Put(blk)
+	}
+}
+
+// wait waits for the given block to be done, recording its error if it has one.
+// It returns true if the block can be used (and afterwards reused).
+func (v *vsoHash) wait(blk *pageBlock) bool {
+	if !blk.wait(v.opts.done()) {
+		return false
+	} else if blk.err != nil {
+		if v.err == nil {
+			v.err = blk.err
+		}
+		return false
+	}
+	return true
+}
+
+// blockHash waits for all the pending pages and appends the hash of the block they make up to b.
+// Unlike finishBlock, this is done synchronously. It returns false if the block couldn't be hashed
+// (see wait), in which case b is returned unchanged.
+func (v *vsoHash) blockHash(b []byte) ([]byte, bool) {
+	blk := v.current
+	blk.release(v.inner)
+	v.current = newPageBlock(v.pagesPerBlock)
+	if !v.wait(blk) {
+		return b, false
+	}
+	b = append(b, blk.sum[:v.inner.Size()]...)
+	blockPool.Put(blk)
+	return b, true
 }
 
 // updateBlobID updates the running blob id with the given hash.
-// It's a bit fiddly because we have to write different things based on whether we are
-// the last block or not, which we generally don't know at the time we do it :(
 func (v *vsoHash) updateBlobID(h []byte) {
-	if v.blobID.Len() == 0 {
-		v.blobID.WriteString(seed)
-		v.blobID.Write(h)
+	if v.err != nil {
+		// An earlier block failed, so chaining anything after it would give a plausible but wrong result.
 		return
 	}
-	v.blobID.WriteByte(0) // that wasn't the last block
-	sum := sha256.Sum256(v.blobID.Bytes())
+	v.blocks++
+	if len(h) == sha256.Size {
+		var b [sha256.Size]byte
+		copy(b[:], h)
+		v.blockHashes = append(v.blockHashes, b)
+		if v.opts.observer != nil {
+			v.opts.observer(v.blocks-1, b)
+		}
+	}
+	b := v.nextBlobID(v.scratch.next[:0], v.blobID.Bytes(), h)
 	v.blobID.Reset()
-	v.blobID.Write(sum[:])
-	v.blobID.Write(h)
+	v.blobID.Write(b)
+	if v.opts.logger != nil {
+		v.opts.logger("vsohash: updated blob id", "block", v.blocks-1, "hash", h, "blobID", b)
+	}
+	v.progress(int64(v.blocks) * int64(v.pageSize*v.pagesPerBlock))
+}
+
+// progress reports the given number of bytes as hashed, if it's more than has been reported already.
+func (v *vsoHash) progress(n int64) {
+	if v.opts.progress != nil && n > v.reported {
+		v.reported = n
+		v.opts.progress(n)
+	}
+}
+
+// These are written after the blob id to indicate whether or not it's for the last block.
+var (
+	notLastBlock = []byte{0}
+	lastBlock    = []byte{1}
+)
+
+// nextBlobID appends to b the blob id that follows the given one once a block with the given hash is added.
+// It's a bit fiddly because we have to write different things based on whether the previous block was
+// the last one or not, which we generally don't know at the time we do it :(
+func (v *vsoHash) nextBlobID(b, blobID, h []byte) []byte {
+	if len(blobID) == 0 {
+		b = append(b, v.opts.blobIDSeed()...)
+		return append(b, h...)
+	}
+	v.inner.Reset()
+	v.inner.Write(blobID)
+	v.inner.Write(notLastBlock)
+	return append(v.inner.Sum(b), h...)
 }
 
 // Sum appends the current hash to b and returns the resulting slice.
-// As noted above, it currently _does_ change the underlying hash state (it is not easy to
-// copy one of these as the stdlib builtin ones do).
-// I'm not certain if anyone will really care about this; I only ever seem to call Sum()
-// once at the end of a hash but if we _really_ cared we could probably try to modify
-// things to support this.
+// It doesn't change the underlying state, so more can be written afterwards (and Sum called
+// again), as for the standard library's hashes.
 func (v *vsoHash) Sum(b []byte) []byte {
-	s := v.sum()
-	return append(b, s[:]...)
+	if err := v.check(); err != nil {
+		panic(err)
+	}
+	b = v.appendSum(b)
+	if v.err != nil {
+		panic(v.err)
+	}
+	return b
 }
 
-// sum calculates and returns the current hash. Underlying state is updated.
+// SumErr returns the current hash, or an error if it can't be calculated: that's the context's error if
+// the hash was created with NewWithContext and it's been cancelled, ErrPoolClosed if its Pool has been closed,
+// a PanicError if hashing any page panicked, or any of the errors options can cause (e.g. ErrEmptyInput).
+// As with Sum, the underlying state is unchanged.
+func (v *vsoHash) SumErr() ([Size]byte, error) {
+	if err := v.check(); err != nil {
+		return [Size]byte{}, err
+	}
+	sum := v.sum()
+	// Finishing the last pages may have found that one of them failed, and if the context was
+	// cancelled while doing so some of them may have been dropped.
+	if v.err != nil {
+		return [Size]byte{}, v.err
+	} else if err := v.opts.ctxErr(); err != nil {
+		return [Size]byte{}, err
+	}
+	return sum, nil
+}
+
+// SumInto is like Sum, but writes the hash into the given array instead of appending it to a slice.
+// It panics (as well as in the same cases as Sum) if the hash isn't Size bytes long, which can only be
+// the case for paged hashes.
+func (v *vsoHash) SumInto(dst *[Size]byte) {
+	if err := v.check(); err != nil {
+		panic(err)
+	} else if v.Size() != Size {
+		panic("SumInto can only be used with hashes of length Size")
+	}
+	v.appendSum(dst[:0])
+	if v.err != nil {
+		panic(v.err)
+	}
+}
+
+// check returns an error if the hash can't be finalised in its current state.
+func (v *vsoHash) check() error {
+	if v.err != nil {
+		return v.err
+	} else if v.pool != nil && v.pool.isClosed() {
+		return ErrPoolClosed
+	}
+	return v.opts.checkSize(v.written)
+}
+
+// sum calculates and returns the current hash.
 func (v *vsoHash) sum() [Size]byte {
-	if v.buffer.Len() != 0 {
-		// We have some pending bytes. Add a task for them.
-		// Note that we can do this synchronously since we know we won't do anything else with the buffer.
-		v.writePage(v.buffer.Bytes())
-	}
-	if len(v.pageHashes) > 0 || v.blobID.Len() == 0 {
-		// We have some pages left, must finish off the last block.
-		// Must also ensure this happens at least once if we never write anything to the hash.
-		v.finishBlock()
+	ret := [Size]byte{}
+	v.appendSum(ret[:0])
+	return ret
+}
+
+// appendSum is like sum but appends the result to the given slice.
+// With WithSelfCheck, it panics if the result doesn't match the sequential hash's.
+func (v *vsoHash) appendSum(b []byte) []byte {
+	if v.shadow == nil {
+		return v.appendHash(b)
+	}
+	start := len(b)
+	b = v.appendHash(b)
+	// It's only meaningful if everything's been hashed; otherwise the result is undefined anyway.
+	if v.err == nil && v.opts.ctxErr() == nil {
+		if expected := v.shadow.appendHash(nil); !bytes.Equal(b[start:], expected) {
+			panic(fmt.Sprintf("vsohash: self-check failed after %d bytes: got %x, sequential hash gives %x", v.written, b[start:], expected))
+		}
+	}
+	return b
+}
+
+// appendHash calculates the current hash and appends it to the given slice.
+func (v *vsoHash) appendHash(b []byte) []byte {
+	last, ok := v.pendingBlockHash(v.scratch.block[:0])
+	// Everything's been hashed now, including any partial block.
+	v.progress(v.written)
+	if v.opts.logger != nil {
+		v.opts.logger("vsohash: finalising", "blocks", v.blocks, "written", v.written, "lastBlock", ok)
+	}
+	if !ok {
+		return v.appendIdentifier(b, v.blobID.Bytes())
+	}
+	// pendingBlockHash may have updated the blob id, so this has to come after it.
+	return v.appendIdentifier(b, v.nextBlobID(v.scratch.next[:0], v.blobID.Bytes(), last))
+}
+
+// pendingBlockHash appends the hash of the incomplete final block to b, without changing the hash's state.
+// It returns false if there isn't one, i.e. if we're at a block boundary. Note that an empty input is
+// still one (empty) block.
+func (v *vsoHash) pendingBlockHash(b []byte) ([]byte, bool) {
+	v.resolveBlocks()
+	if v.opts.cache != nil {
+		if len(v.block) == 0 && v.blobID.Len() != 0 {
+			return b, false
+		}
+		h := v.opts.hashBlock(v.block)
+		return append(b, h[:]...), true
+	} else if v.current.n == 0 && v.buffer.Len() == 0 && v.blobID.Len() != 0 {
+		return b, false
 	}
-	v.blobID.WriteByte(1) // this is the last block
-	b := sha256.Sum256(v.blobID.Bytes())
+	size := v.inner.Size()
+	// The pending bytes in the buffer aren't enough to be worth dispatching, so they're hashed here.
+	last := &v.scratch.last
+	if v.buffer.Len() > 0 {
+		v.inner.Reset()
+		v.inner.Write(v.buffer.Bytes())
+		v.inner.Sum(last[:0])
+	}
+	pages := v.peekPages()
+	v.inner.Reset()
+	for i := range pages {
+		v.inner.Write(pages[i][:size])
+	}
+	if v.buffer.Len() > 0 {
+		v.inner.Write(last[:size])
+	}
+	return v.inner.Sum(b), true
+}
+
+// peekPages waits for all the pages of the current block that have been dispatched so far and returns
+// their hashes, without finishing the block (so more pages can still be added to it).
+// If the hash's context is cancelled first, the returned hashes are meaningless.
+func (v *vsoHash) peekPages() []digest {
+	blk := v.current
+	if blk.n == 0 {
+		return nil
+	}
+	// The only way to know they're all done is to finish the block, so do that and then start it again
+	// with the same pages.
+	n := blk.n
+	blk.release(v.inner)
+	v.current = newPageBlock(v.pagesPerBlock)
+	v.current.n = n
+	if v.wait(blk) {
+		copy(v.current.pages, blk.pages[:n])
+		blockPool.Put(blk)
+	}
+	return v.current.pages[:n]
+}
+
+// identifier returns the identifier of everything written so far, treating the most recent block
+// as the last one. It must only be called at a block boundary (i.e. with no pending pages).
+func (v *vsoHash) identifier() [Size]byte {
+	v.resolveBlocks()
 	ret := [Size]byte{}
-	copy(ret[:], b[:])
-	ret[Size-1] = 0
+	v.appendIdentifier(ret[:0], v.blobID.Bytes())
 	return ret
 }
 
+// appendIdentifier appends the identifier corresponding to the given blob id to b, treating the
+// blob id's most recent block as the last one.
+func (v *vsoHash) appendIdentifier(b, blobID []byte) []byte {
+	v.inner.Reset()
+	v.inner.Write(blobID)
+	v.inner.Write(lastBlock)
+	return append(v.inner.Sum(b), v.suffix...)
+}
+
+// Reset resets the hash to its initial state. Any options it was created with are preserved, as is
+// its structure (for paged hashes), so it can be reused as though it were newly created.
+// Any pages that are still being hashed are waited for, so that once it returns none of the workers
+// (or slots from WithMaxInFlightPages) are still held up with them, and their buffers have been recycled.
 func (v *vsoHash) Reset() {
-	v.pageHashes = make([]<-chan [sha256.Size]byte, 0, pagesPerBlock)
+	for _, blk := range v.pendingBlocks {
+		v.discard(blk)
+	}
+	v.current.release(v.inner)
+	v.discard(v.current)
+	v.current = newPageBlock(v.pagesPerBlock)
+	v.pendingBlocks = nil
 	v.blobID.Reset()
+	v.blocks = 0
+	v.written = 0
+	v.blockHashes = v.blockHashes[:0]
 	v.buffer.Reset()
+	v.block = v.block[:0]
+	v.reported = 0
+	v.pages = 0
+	v.err = nil
+	if v.shadow != nil {
+		v.shadow.Reset()
+	}
+}
+
+// ResetParallel is like Reset, but also changes the number of pages the hash calculates in parallel, stopping
+// its current workers and starting new ones as needed. That lets a hash that's reused for inputs of very
+// different sizes (e.g. from a HasherPool) be set up for each one. The same limits apply as when it was
+// created (so it may end up with fewer workers than asked for); any parallelism from WithParallelism or
+// WithExpectedSize is replaced by this.
+// It must only be called when nothing else is using the hash. It panics for hashes from a Pool, whose
+// workers belong to the pool.
+func (v *vsoHash) ResetParallel(parallelism int) {
+	if parallelism <= 0 {
+		panic("Parallelism must be strictly positive")
+	} else if v.tasks != nil && v.running == nil {
+		panic("ResetParallel can't be used with hashes from a Pool")
+	}
+	v.Reset()
+	if v.running != nil && !v.closed {
+		runtime.SetFinalizer(v, nil)
+		finalize(v)
+		v.running.Wait()
+	}
+	v.tasks = nil
+	v.workers = nil
+	v.running = nil
+	v.started = 0
+	if !v.closed {
+		v.setParallelism(parallelism)
+	}
+}
+
+// discard waits for a finished block and then returns it to the pool, without using its hash.
+func (v *vsoHash) discard(blk *pageBlock) {
+	if blk.wait(v.opts.done()) {
+		blockPool.Put(blk)
+	}
+}
+
+// isVSOHash returns true if this is a standard VSO-Hash (as opposed to a paged hash with some other structure).
+func (v *vsoHash) isVSOHash() bool {
+	return v.pageSize == PageSize && v.pagesPerBlock == PagesPerBlock && v.Size() == Size
+}
+
+// BytesWritten returns the total number of bytes written to the hash so far.
+func (v *vsoHash) BytesWritten() int64 {
+	return v.written
+}
+
+// Stats describes what a hash has done so far.
+type Stats struct {
+	// The total number of bytes written to the hash.
+	BytesWritten int64
+	// The number of whole pages that have been hashed. This doesn't include pages that weren't
+	// hashed because their block was found in the block cache, nor a partial page at the end of the input.
+	PagesHashed int64
+	// The number of whole blocks that have been finished.
+	BlocksFinished int
+}
+
+// Stats returns statistics about the hash so far. It doesn't affect the hash's state.
+func (v *vsoHash) Stats() Stats {
+	return Stats{
+		BytesWritten:   v.written,
+		PagesHashed:    v.pages,
+		BlocksFinished: v.blocks + len(v.pendingBlocks),
+	}
 }
 
 func (v *vsoHash) Size() int {
-	return Size
+	return v.inner.Size() + len(v.suffix)
 }
 
 // PageSize is more appropriate here than BlockSize; we write a page at a time which is mildly
 // more efficient for us, but there is little difference to writing a whole block at a time.
 func (v *vsoHash) BlockSize() int {
-	return PageSize
+	return v.pageSize
 }
 
 // Sum calculates the VSO-Hash for the given input.
 func Sum(in []byte) [Size]byte {
+	if len(in) <= PageSize {
+		// There's nothing to parallelise here, so don't bother starting any workers.
+		h := NewSequential().(*vsoHash)
+		h.Write(in)
+		return h.sum()
+	}
 	h := New().(*vsoHash)
+	defer h.Close()
 	h.Write(in)
 	return h.sum()
 }
@@ -1,22 +1,29 @@
 package vsohash
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"time"
 
 	"testing"
 )
 
-func BenchmarkVSOHash(b *testing.B) {
-	// Need quite a bit of data to give our hashes a chance to shine.
-	const size = 2 * 1024 * 1024 * 1024
+// Need quite a bit of data to give our hashes a chance to shine.
+const benchmarkSize = 2 * 1024 * 1024 * 1024
 
-	data := make([]byte, size)
-	for i := uint64(0); i < size; i += 8 {
+func benchmarkData() []byte {
+	data := make([]byte, benchmarkSize)
+	for i := uint64(0); i < benchmarkSize; i += 8 {
 		binary.LittleEndian.PutUint64(data[i:], i)
 	}
+	return data
+}
+
+func BenchmarkVSOHash(b *testing.B) {
+	data := benchmarkData()
 	b.ResetTimer()
 
 	b.Run("SHA256", func(b *testing.B) {
@@ -24,9 +31,27 @@ func BenchmarkVSOHash(b *testing.B) {
 		for i := 0; i < b.N; i++ {
 			sha256.Sum256(data)
 		}
-		b.ReportMetric(float64(size*b.N)/(1024*1024*time.Since(start).Seconds()), "MB/s")
+		reportThroughput(b, start)
+	})
+	// This is whichever implementation the hash is using; build with -tags sha256simd to compare the two.
+	b.Run("SHA256Inner", func(b *testing.B) {
+		start := time.Now()
+		for i := 0; i < b.N; i++ {
+			sum256(data)
+		}
+		reportThroughput(b, start)
+	})
+	b.Run("VSOSequential", func(b *testing.B) {
+		start := time.Now()
+		for i := 0; i < b.N; i++ {
+			h := NewSequential()
+			h.Write(data)
+			h.Sum(nil)
+		}
+		reportThroughput(b, start)
 	})
-	for _, parallelism := range []int{1, 2, 4, 8, 16, 24} {
+	// Workers are capped at PagesPerBlock, so 48 should be no different to 32.
+	for _, parallelism := range []int{1, 2, 4, 8, 16, 24, 32, 48} {
 		b.Run(fmt.Sprintf("VSOParallel%d", parallelism), func(b *testing.B) {
 			start := time.Now()
 			for i := 0; i < b.N; i++ {
@@ -34,7 +59,75 @@ func BenchmarkVSOHash(b *testing.B) {
 				h.Write(data)
 				h.Sum(nil)
 			}
-			b.ReportMetric(float64(size*b.N)/(1024*1024*time.Since(start).Seconds()), "MB/s")
+			reportThroughput(b, start)
+		})
+		b.Run(fmt.Sprintf("VSOAffinity%d", parallelism), func(b *testing.B) {
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				h := NewParallel(parallelism, WithAffinity(true))
+				h.Write(data)
+				h.Sum(nil)
+			}
+			reportThroughput(b, start)
+		})
+	}
+}
+
+// BenchmarkEntryPoints compares the different ways of getting data into the hash.
+func BenchmarkEntryPoints(b *testing.B) {
+	data := benchmarkData()
+	b.ResetTimer()
+
+	for _, parallelism := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("WriteParallel%d", parallelism), func(b *testing.B) {
+			b.ReportAllocs()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				h := NewParallel(parallelism)
+				h.Write(data)
+				h.Sum(nil)
+			}
+			reportThroughput(b, start)
+		})
+		// Small writes, like io.Copy's, which are all copied and so shouldn't have to wait for anything.
+		b.Run(fmt.Sprintf("Write32KParallel%d", parallelism), func(b *testing.B) {
+			b.ReportAllocs()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				h := NewParallel(parallelism)
+				for j := 0; j < len(data); j += 32 * 1024 {
+					h.Write(data[j : j+32*1024])
+				}
+				h.Sum(nil)
+			}
+			reportThroughput(b, start)
+		})
+		b.Run(fmt.Sprintf("CopyParallel%d", parallelism), func(b *testing.B) {
+			b.ReportAllocs()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				h := NewParallel(parallelism)
+				// Hide the reader's WriteTo so io.Copy has to go via the hash.
+				if _, err := io.Copy(h, struct{ io.Reader }{bytes.NewReader(data)}); err != nil {
+					b.Fatalf("Failed to copy: %s", err)
+				}
+				h.Sum(nil)
+			}
+			reportThroughput(b, start)
+		})
+		b.Run(fmt.Sprintf("ReaderAtParallel%d", parallelism), func(b *testing.B) {
+			b.ReportAllocs()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				if _, err := SumReaderAt(bytes.NewReader(data), benchmarkSize, parallelism); err != nil {
+					b.Fatalf("Failed to hash: %s", err)
+				}
+			}
+			reportThroughput(b, start)
 		})
 	}
 }
+
+func reportThroughput(b *testing.B, start time.Time) {
+	b.ReportMetric(float64(benchmarkSize*b.N)/(1024*1024*time.Since(start).Seconds()), "MB/s")
+}
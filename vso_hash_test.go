@@ -1,12 +1,26 @@
 package vsohash
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHashAlgorithmIsStable(t *testing.T) {
@@ -28,52 +42,1138 @@ func TestBlockHashesDoNotChange(t *testing.T) {
 		BlockSize:     "e8deef25ed53357d2a738d7156067e69892a7bdc190818cd2ad698a3a1f95e03",
 	} {
 		t.Run(fmt.Sprintf("Sequential%d", lim), func(t *testing.T) {
-			in := make([]byte, lim)
-			for i := 0; i < lim; i++ {
-				in[i] = byte(i & 0xff)
-			}
+			in := sequentialInput(lim)
 			h := New()
 			h.Write(in)
 			h.Sum(nil)
 			sum := lastBlockSum(h.(*vsoHash))
 			assert.Equal(t, hash, hex.EncodeToString(sum))
+			blockHash := BlockHash(in)
+			assert.Equal(t, hash, hex.EncodeToString(blockHash[:]))
 		})
 	}
 }
 
-// lastBlockSum is a helper for tests; it is pretty nasty in terms of how deeply it reaches into the
-// internals of the hasher, but we don't provide block hashing as an external implementation and it's
-// hard to do so without providing a heap of custom entry points.
+// lastBlockSum is a helper for tests that returns the hash of the last block written to the hasher.
 func lastBlockSum(v *vsoHash) []byte {
-	if b := v.blobID.Bytes(); len(b) > sha256.Size {
-		return b[len(b)-sha256.Size-1 : len(b)-1]
-	}
-	h := sha256.Sum256(v.buffer.Bytes())
-	return h[:]
+	hashes := v.BlockHashes()
+	return hashes[len(hashes)-1][:]
+}
+
+// blobIDVectors are the expected identifiers for sequential inputs of various lengths.
+// These cases are taken from VsoHashTests.cs
+var blobIDVectors = map[int]string{
+	0:               "1e57cf2792a900d06c1cdfb3c453f35bc86f72788aa9724c96c929d1cc6b456a00",
+	1:               "3da32150b5e69b54e7ad1765d9573bc5e6e05d3b6529556c1b4a436a76a511f400",
+	PageSize - 1:    "4ae1ad6462d75d117a5dafcf98167981371a4b21e1cee49d0b982de2ce01032300",
+	PageSize:        "85840e1cb7cbfd78b464921c54c96f68c19066f20860efa8cce671b40ba5162300",
+	PageSize + 1:    "d92a37c547f9d5b6b7b791a24f587da8189cca14ebc8511d2482e7448763e2bd00",
+	BlockSize - 1:   "1c3c73f7e829e84a5ba05631195105fb49e033fa23bda6d379b3e46b5d73ef3700",
+	BlockSize:       "6dae3ed3e623aed293297c289c3d20a53083529138b7631e99920ef0d93af3cd00",
+	BlockSize + 1:   "1f9f3c008ea37ecb65bc5fb14a420cebb3ca72a9601ec056709a6b431f91807100",
+	2*BlockSize - 1: "df0e0db15e866592dbfa9bca74e6d547d67789f7eb088839fc1a5cefa862353700",
+	2 * BlockSize:   "5e3a80b2acb2284cd21a08979c49cbb80874e1377940699b07a8abee9175113200",
+	2*BlockSize + 1: "b9a44a420593fa18453b3be7b63922df43c93ff52d88f2cab26fe1fadba7003100",
 }
 
 func TestBlobIDsDoNotChange(t *testing.T) {
-	// These cases are taken from VsoHashTests.cs
-	for lim, hash := range map[int]string{
-		0:               "1e57cf2792a900d06c1cdfb3c453f35bc86f72788aa9724c96c929d1cc6b456a00",
-		1:               "3da32150b5e69b54e7ad1765d9573bc5e6e05d3b6529556c1b4a436a76a511f400",
-		PageSize - 1:    "4ae1ad6462d75d117a5dafcf98167981371a4b21e1cee49d0b982de2ce01032300",
-		PageSize:        "85840e1cb7cbfd78b464921c54c96f68c19066f20860efa8cce671b40ba5162300",
-		PageSize + 1:    "d92a37c547f9d5b6b7b791a24f587da8189cca14ebc8511d2482e7448763e2bd00",
-		BlockSize - 1:   "1c3c73f7e829e84a5ba05631195105fb49e033fa23bda6d379b3e46b5d73ef3700",
-		BlockSize:       "6dae3ed3e623aed293297c289c3d20a53083529138b7631e99920ef0d93af3cd00",
-		BlockSize + 1:   "1f9f3c008ea37ecb65bc5fb14a420cebb3ca72a9601ec056709a6b431f91807100",
-		2*BlockSize - 1: "df0e0db15e866592dbfa9bca74e6d547d67789f7eb088839fc1a5cefa862353700",
-		2 * BlockSize:   "5e3a80b2acb2284cd21a08979c49cbb80874e1377940699b07a8abee9175113200",
-		2*BlockSize + 1: "b9a44a420593fa18453b3be7b63922df43c93ff52d88f2cab26fe1fadba7003100",
-	} {
+	for lim, hash := range blobIDVectors {
 		t.Run(fmt.Sprintf("Sequential%d", lim), func(t *testing.T) {
-			in := make([]byte, lim)
-			for i := 0; i < lim; i++ {
-				in[i] = byte(i & 0xff)
-			}
+			in := sequentialInput(lim)
 			sum := Sum(in)
 			assert.Equal(t, hash, hex.EncodeToString(sum[:]))
 		})
 	}
 }
+
+// sequentialInput returns an input of the given length with an incrementing byte pattern, as used by the BuildXL tests.
+func sequentialInput(n int) []byte {
+	in := make([]byte, n)
+	for i := 0; i < n; i++ {
+		in[i] = byte(i & 0xff)
+	}
+	return in
+}
+
+// blockHashesOf returns the hashes of each block of the given input.
+func blockHashesOf(in []byte) [][sha256.Size]byte {
+	var hashes [][sha256.Size]byte
+	for i := 0; i == 0 || i < len(in); i += BlockSize {
+		end := i + BlockSize
+		if end > len(in) {
+			end = len(in)
+		}
+		hashes = append(hashes, BlockHash(in[i:end]))
+	}
+	return hashes
+}
+
+func TestResetPreservesOptions(t *testing.T) {
+	cache := newMapCache()
+	in := repeatedBlocks(2, 0)
+	h := New(WithBlockCache(cache))
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+	assert.Equal(t, 1, cache.hits)
+	h.Reset()
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+	assert.Equal(t, 3, cache.hits)
+}
+
+func TestResetWaitsForPages(t *testing.T) {
+	in := sequentialInput(BlockSize + PageSize + 5)
+	for _, parallelism := range []int{1, 4} {
+		h := NewParallel(parallelism, WithMaxInFlightPages(2)).(*vsoHash)
+		h.Write(sequentialInput(3*PageSize + 7))
+		h.WriteString(string(sequentialInput(PageSize)))
+		h.Reset()
+		assert.Equal(t, 0, len(h.inFlight), "no slots should still be held")
+		assert.Equal(t, Stats{}, h.Stats())
+		h.Write(in)
+		assert.Equal(t, Sum(in), sumArray(h))
+		h.Close()
+	}
+}
+
+func TestResetParallel(t *testing.T) {
+	in := sequentialInput(2*BlockSize + PageSize + 5)
+	before := runtime.NumGoroutine()
+	h := NewParallel(1).(*vsoHash)
+	defer h.Close()
+	for _, parallelism := range []int{4, 8, 1, 2} {
+		h.Write(in[:PageSize+1])
+		h.ResetParallel(parallelism)
+		h.Write(in)
+		assert.Equal(t, Sum(in), sumArray(h))
+		if parallelism == 1 {
+			assert.Nil(t, h.tasks)
+		} else {
+			assert.Equal(t, parallelism, cap(h.tasks))
+		}
+	}
+	h.ResetParallel(1)
+	waitForGoroutines(t, before)
+}
+
+func TestResetParallelPool(t *testing.T) {
+	p := NewPool(2)
+	defer p.Close()
+	assert.Panics(t, func() { NewFromPool(p).(Hasher).ResetParallel(2) })
+}
+
+func TestResetPreservesStructure(t *testing.T) {
+	in := sequentialInput(10000)
+	h := NewPagedHash(sha256.New, 4096, 1024, 2)
+	h.Write([]byte("something else entirely"))
+	h.Sum(nil)
+	h.Reset()
+	h.Write(in)
+	assert.Equal(t, pagedSum(sha256.New(), in, 4096, 1024), h.Sum(nil))
+	assert.Equal(t, 1024, h.BlockSize())
+}
+
+func TestRejectEmpty(t *testing.T) {
+	h := New(WithRejectEmpty(true)).(Hasher)
+	_, err := h.SumErr()
+	assert.Equal(t, ErrEmptyInput, err)
+	assert.Panics(t, func() { h.Sum(nil) })
+	h.Write([]byte{1})
+	sum, err := h.SumErr()
+	assert.NoError(t, err)
+	assert.Equal(t, Sum([]byte{1}), sum)
+	// Writing nothing doesn't count as writing something.
+	h.Reset()
+	h.Write(nil)
+	_, err = h.SumErr()
+	assert.Equal(t, ErrEmptyInput, err)
+}
+
+func TestEmptyPermittedByDefault(t *testing.T) {
+	h := New().(Hasher)
+	sum, err := h.SumErr()
+	assert.NoError(t, err)
+	assert.Equal(t, Sum(nil), sum)
+}
+
+func TestWriteReturnsFullLength(t *testing.T) {
+	// io.Copy uses a 32KB buffer, so the second write will straddle a page boundary.
+	in := sequentialInput(BlockSize + PageSize + 1)
+	h := New()
+	n, err := io.Copy(h, struct{ io.Reader }{bytes.NewReader(in)})
+	assert.NoError(t, err)
+	assert.EqualValues(t, len(in), n)
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestParallelSemaphore(t *testing.T) {
+	// Two hashes sharing a budget of one worker between them should still work fine.
+	sem := make(chan struct{}, 1)
+	in := sequentialInput(2*BlockSize + 1)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			h := NewParallelSem(4, sem)
+			h.Write(in)
+			assert.Equal(t, Sum(in), sumArray(h))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 0, len(sem))
+}
+
+func TestParallelSemaphoreLimitsConcurrency(t *testing.T) {
+	// Hold the only slot; nothing should be able to make progress until we let it go.
+	sem := make(chan struct{}, 1)
+	sem <- struct{}{}
+	h := NewParallelSem(4, sem)
+	done := make(chan struct{})
+	go func() {
+		h.Write(sequentialInput(BlockSize))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Hash completed a block without acquiring the semaphore")
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-sem
+	<-done
+}
+
+func TestAffinity(t *testing.T) {
+	for _, lim := range []int{0, 1, PageSize + 1, BlockSize, 2*BlockSize + PageSize} {
+		t.Run(fmt.Sprintf("Size%d", lim), func(t *testing.T) {
+			in := sequentialInput(lim)
+			h := NewParallel(3, WithAffinity(true))
+			h.Write(in)
+			assert.Equal(t, Sum(in), sumArray(h))
+		})
+	}
+}
+
+func TestRequireBlockAlignment(t *testing.T) {
+	for _, lim := range []int{0, BlockSize, 3 * BlockSize} {
+		h := New(WithRequireBlockAlignment(true)).(Hasher)
+		h.Write(sequentialInput(lim))
+		sum, err := h.SumErr()
+		assert.NoError(t, err)
+		assert.Equal(t, Sum(sequentialInput(lim)), sum)
+	}
+	h := New(WithRequireBlockAlignment(true)).(Hasher)
+	h.Write(sequentialInput(BlockSize + 1))
+	_, err := h.SumErr()
+	var alignmentErr *BlockAlignmentError
+	assert.ErrorAs(t, err, &alignmentErr)
+	assert.EqualValues(t, BlockSize+1, alignmentErr.Size)
+	assert.EqualValues(t, BlockSize, alignmentErr.Nearest())
+	assert.EqualError(t, err, "vsohash: input size 2097153 is not a multiple of the block size 2097152; the nearest valid size is 2097152")
+	assert.Panics(t, func() { h.Sum(nil) })
+}
+
+func TestBlockAlignmentErrorNearest(t *testing.T) {
+	assert.EqualValues(t, 0, (&BlockAlignmentError{Size: 1}).Nearest())
+	assert.EqualValues(t, BlockSize, (&BlockAlignmentError{Size: BlockSize / 2}).Nearest())
+	assert.EqualValues(t, 2*BlockSize, (&BlockAlignmentError{Size: 2*BlockSize - 1}).Nearest())
+}
+
+func TestCloseReleasesGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	h := NewParallel(8).(*vsoHash)
+	h.Write(sequentialInput(BlockSize + 1))
+	h.Sum(nil)
+	assert.NoError(t, h.Close())
+	// The goroutines should be gone by the time Close returns.
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+	assert.NoError(t, h.Close()) // Closing twice is fine
+}
+
+func TestCloser(t *testing.T) {
+	in := sequentialInput(PageSize * 3)
+	h := New()
+	defer h.(io.Closer).Close()
+	var w io.WriteCloser = h.(Hasher)
+	w.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestFinalizerReleasesGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+	h := NewParallel(8)
+	h.Write(sequentialInput(PageSize + 1))
+	h.Sum(nil)
+	h = nil
+	for i := 0; i < 10 && runtime.NumGoroutine() > before; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitForGoroutines(t, before)
+}
+
+func TestWithoutFinalizer(t *testing.T) {
+	before := runtime.NumGoroutine()
+	h := NewParallel(8, WithoutFinalizer()).(*vsoHash)
+	h.Write(sequentialInput(2 * PageSize))
+	h.Sum(nil)
+	// Hang onto enough to clean up the workers ourselves afterwards.
+	tasks, running := h.tasks, h.running
+	h = nil
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Greater(t, runtime.NumGoroutine(), before)
+	close(tasks)
+	running.Wait()
+}
+
+// waitForGoroutines waits a little while for the number of goroutines to drop to the given number.
+// It can also end up lower if hashes left behind by other tests are collected in the meantime.
+func waitForGoroutines(t *testing.T, n int) {
+	for i := 0; i < 100 && runtime.NumGoroutine() > n; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), n)
+}
+
+func TestStraddlingWritesReuseBuffers(t *testing.T) {
+	// Write in chunks that never line up with pages, so every page goes through the copying path
+	// (and hence the buffer pool), and check nothing gets corrupted by buffers being reused.
+	in := sequentialInput(4*BlockSize + 12345)
+	for i := 0; i < 3; i++ {
+		h := NewParallel(4)
+		for b := in; len(b) > 0; {
+			n := 10007
+			if n > len(b) {
+				n = len(b)
+			}
+			h.Write(b[:n])
+			b = b[n:]
+		}
+		assert.Equal(t, Sum(in), sumArray(h))
+		h.(Hasher).Close()
+	}
+}
+
+func TestConcurrentHashes(t *testing.T) {
+	// Several hashes running at once, each resetting and reusing its state; make sure none of them
+	// picks up another's page hashes.
+	inputs := [][]byte{
+		sequentialInput(3*BlockSize + 17),
+		bytes.Repeat([]byte{0xab}, 2*BlockSize),
+		sequentialInput(PageSize - 1),
+	}
+	var wg sync.WaitGroup
+	for _, in := range inputs {
+		wg.Add(1)
+		go func(in []byte) {
+			defer wg.Done()
+			for i := 0; i < 3; i++ {
+				h := NewParallel(2)
+				h.Write(in)
+				assert.Equal(t, Sum(in), sumArray(h))
+				h.Reset()
+				h.Write(in)
+				assert.Equal(t, Sum(in), sumArray(h))
+				h.(Hasher).Close()
+			}
+		}(in)
+	}
+	wg.Wait()
+}
+
+func TestContext(t *testing.T) {
+	in := sequentialInput(3*BlockSize + 17)
+	h := NewWithContext(context.Background(), 4)
+	defer h.(io.Closer).Close()
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestContextCancelled(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	h := NewWithContext(ctx, 8)
+	n, err := h.Write(sequentialInput(BlockSize + 1))
+	assert.NoError(t, err)
+	assert.Equal(t, BlockSize+1, n)
+	cancel()
+	// The workers should exit without the hash being closed.
+	waitForGoroutines(t, before)
+	n, err = h.Write(sequentialInput(BlockSize))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, n)
+	h.Sum(nil) // The result is undefined, but it mustn't block.
+	_, err = h.(Hasher).SumErr()
+	assert.Equal(t, context.Canceled, err)
+	assert.NoError(t, h.(io.Closer).Close())
+}
+
+// A countdownContext is a context that's cancelled once Err has been called a given number of times.
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (ctx *countdownContext) Err() error {
+	if ctx.n--; ctx.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestContextCancelledMidWrite(t *testing.T) {
+	in := sequentialInput(3*PageSize + 5)
+	for name, write := range map[string]func(h Hasher) (int, error){
+		"Write":       func(h Hasher) (int, error) { return h.Write(in) },
+		"WriteString": func(h Hasher) (int, error) { return h.WriteString(string(in)) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Let it get through the initial checks and a couple of pages.
+			h := NewWithContext(&countdownContext{Context: context.Background(), n: 3}, 1).(Hasher)
+			defer h.Close()
+			h.Write(in[:7])
+			n, err := write(h)
+			assert.Equal(t, context.Canceled, err)
+			assert.Less(t, n, len(in))
+			assert.EqualValues(t, 7+n, h.BytesWritten())
+		})
+	}
+}
+
+func TestMaxInFlightPages(t *testing.T) {
+	in := sequentialInput(2*BlockSize + PageSize + 1)
+	h := NewParallel(4, WithMaxInFlightPages(1))
+	defer h.(io.Closer).Close()
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestMaxInFlightPagesLimitsOutstandingPages(t *testing.T) {
+	// Hold the workers up with a semaphore, so pages can't finish until we let them.
+	sem := make(chan struct{}, 1)
+	sem <- struct{}{}
+	in := sequentialInput(2 * BlockSize)
+	h := NewParallelSem(8, sem, WithMaxInFlightPages(3)).(*vsoHash)
+	defer h.Close()
+	done := make(chan struct{})
+	go func() {
+		h.Write(in)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Write completed without any pages being hashed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, 3, len(h.inFlight))
+	<-sem
+	<-done
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestMaxInFlightPagesMustBePositive(t *testing.T) {
+	assert.Panics(t, func() { WithMaxInFlightPages(0) })
+}
+
+func TestSumIsRepeatable(t *testing.T) {
+	in := sequentialInput(3*BlockSize + PageSize + 17)
+	for _, cached := range []bool{false, true} {
+		for _, split := range []int{0, 1, PageSize - 1, PageSize, BlockSize, BlockSize + 3, 2*BlockSize + PageSize} {
+			t.Run(fmt.Sprintf("Split%dCached%v", split, cached), func(t *testing.T) {
+				var opts []Option
+				if cached {
+					opts = append(opts, WithBlockCache(newMapCache()))
+				}
+				h := New(opts...)
+				defer h.(io.Closer).Close()
+				h.Write(in[:split])
+				assert.Equal(t, Sum(in[:split]), sumArray(h))
+				assert.Equal(t, Sum(in[:split]), sumArray(h))
+				// Writing can carry on afterwards as though Sum wasn't called.
+				h.Write(in[split:])
+				assert.Equal(t, Sum(in), sumArray(h))
+			})
+		}
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	in := sequentialInput(BlockSize + PageSize + 1)
+	h := NewParallel(2)
+	h.Write(in)
+	require.NoError(t, h.(io.Closer).Close())
+	n, err := h.Write([]byte("more"))
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, 0, n)
+	// Sum still works after closing though.
+	assert.Equal(t, Sum(in), sumArray(h))
+	h.Reset()
+	_, err = h.Write(in)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestReadFrom(t *testing.T) {
+	in := sequentialInput(3*BlockSize + PageSize + 17)
+	for name, r := range map[string]func([]byte) io.Reader{
+		"Whole":   func(b []byte) io.Reader { return bytes.NewReader(b) },
+		"OneByte": func(b []byte) io.Reader { return iotest.OneByteReader(bytes.NewReader(b[:PageSize+3])) },
+		"Half":    func(b []byte) io.Reader { return iotest.HalfReader(bytes.NewReader(b)) },
+		"DataErr": func(b []byte) io.Reader { return iotest.DataErrReader(bytes.NewReader(b)) },
+	} {
+		for _, cached := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%sCached%v", name, cached), func(t *testing.T) {
+				var opts []Option
+				if cached {
+					opts = append(opts, WithBlockCache(newMapCache()))
+				}
+				h := New(opts...)
+				defer h.(io.Closer).Close()
+				// Start off misaligned so it has to catch up to a page boundary.
+				h.Write(in[:100])
+				rest := r(in[100:])
+				n, err := h.(io.ReaderFrom).ReadFrom(rest)
+				require.NoError(t, err)
+				expected := in[:100+n]
+				assert.Equal(t, Sum(expected), sumArray(h))
+			})
+		}
+	}
+}
+
+func TestReadFromCopy(t *testing.T) {
+	// io.Copy should pick up ReadFrom (the wrapper hides bytes.Reader's WriteTo so it doesn't get used instead).
+	in := sequentialInput(2*BlockSize + 1)
+	h := New()
+	defer h.(io.Closer).Close()
+	n, err := io.Copy(h, struct{ io.Reader }{bytes.NewReader(in)})
+	require.NoError(t, err)
+	assert.EqualValues(t, len(in), n)
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestReadFromPagedHash(t *testing.T) {
+	in := sequentialInput(100000)
+	h := NewPagedHash(sha256.New, 4096, 1024, 3)
+	n, err := h.(io.ReaderFrom).ReadFrom(bytes.NewReader(in))
+	require.NoError(t, err)
+	assert.EqualValues(t, len(in), n)
+	assert.Equal(t, pagedSum(sha256.New(), in, 4096, 1024), h.Sum(nil))
+}
+
+func TestReadFromError(t *testing.T) {
+	in := sequentialInput(PageSize + 1)
+	h := New()
+	defer h.(io.Closer).Close()
+	n, err := h.(io.ReaderFrom).ReadFrom(io.MultiReader(bytes.NewReader(in), &errorReader{err: errors.New("kaboom")}))
+	assert.EqualError(t, err, "kaboom")
+	// Everything that was read should still have been written.
+	assert.EqualValues(t, len(in), n)
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestManyBlocksInOneWrite(t *testing.T) {
+	// Enough blocks that some have to wait for earlier ones to be added to the blob id.
+	in := sequentialInput((maxPendingBlocks+3)*BlockSize + PageSize + 1)
+	p := NewPool(3)
+	defer p.Close()
+	for name, h := range map[string]hash.Hash{
+		"Parallel": NewParallel(3),
+		"Affinity": NewParallel(3, WithAffinity(true)),
+		"Pool":     NewFromPool(p),
+		"Limited":  NewParallel(3, WithMaxInFlightPages(1)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer h.(io.Closer).Close()
+			h.Write(in)
+			assert.Equal(t, blockHashesOf(in), h.(Hasher).BlockHashes())
+			assert.Equal(t, Sum(in), sumArray(h))
+		})
+	}
+}
+
+func TestSumSmallInputs(t *testing.T) {
+	for _, n := range []int{0, 1, PageSize - 1, PageSize} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			in := sequentialInput(n)
+			h := NewParallel(2)
+			defer h.(io.Closer).Close()
+			h.Write(in)
+			before := runtime.NumGoroutine()
+			assert.Equal(t, sumArray(h), Sum(in))
+			assert.Equal(t, before, runtime.NumGoroutine())
+		})
+	}
+}
+
+func TestSequential(t *testing.T) {
+	for lim, hash := range blobIDVectors {
+		t.Run(fmt.Sprint(lim), func(t *testing.T) {
+			in := sequentialInput(lim)
+			before := runtime.NumGoroutine()
+			h := NewSequential()
+			h.Write(in[:lim/3])
+			h.Write(in[lim/3:])
+			assert.Equal(t, before, runtime.NumGoroutine())
+			assert.Equal(t, hash, hex.EncodeToString(h.Sum(nil)))
+			assert.Equal(t, blockHashesOf(in), h.(Hasher).BlockHashes())
+			assert.NoError(t, h.(io.Closer).Close())
+		})
+	}
+}
+
+func TestAuto(t *testing.T) {
+	for _, n := range []int{0, 1, PageSize, 3*PageSize + 1, 3*BlockSize + 17} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			in := sequentialInput(n)
+			h := NewAuto(n)
+			defer h.(io.Closer).Close()
+			if v := h.(*vsoHash); n <= PageSize || runtime.GOMAXPROCS(0) == 1 {
+				assert.Nil(t, v.tasks)
+			} else {
+				assert.LessOrEqual(t, cap(v.tasks), (n+PageSize-1)/PageSize)
+				assert.LessOrEqual(t, cap(v.tasks), PagesPerBlock)
+			}
+			h.Write(in)
+			assert.Equal(t, Sum(in), sumArray(h))
+		})
+	}
+}
+
+func TestAutoHugeSize(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	h := NewAuto(math.MaxInt)
+	defer h.(io.Closer).Close()
+	assert.Equal(t, 4, cap(h.(*vsoHash).tasks))
+}
+
+func TestAutoUnknownSize(t *testing.T) {
+	in := sequentialInput(BlockSize + 1)
+	h := NewAuto(-1)
+	defer h.(io.Closer).Close()
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		assert.Equal(t, n, cap(h.(*vsoHash).tasks))
+	}
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestWorkersStartedLazily(t *testing.T) {
+	before := runtime.NumGoroutine()
+	h := NewParallel(8).(*vsoHash)
+	defer h.Close()
+	assert.Equal(t, before, runtime.NumGoroutine())
+	in := sequentialInput(BlockSize + 1)
+	h.Write(in[:3*PageSize])
+	assert.Equal(t, 3, h.started)
+	h.Write(in[3*PageSize:])
+	assert.Equal(t, 8, h.started)
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestAffinityWorkersStartedLazily(t *testing.T) {
+	h := NewParallel(8, WithAffinity(true)).(*vsoHash)
+	defer h.Close()
+	in := sequentialInput(BlockSize + 1)
+	h.Write(in[:3*PageSize])
+	assert.Equal(t, 3, h.started)
+	h.Write(in[3*PageSize:])
+	assert.Equal(t, 8, h.started)
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestParallelismOneIsInline(t *testing.T) {
+	in := sequentialInput(BlockSize + 1)
+	before := runtime.NumGoroutine()
+	h := NewParallel(1)
+	h.Write(in)
+	assert.Nil(t, h.(*vsoHash).tasks)
+	assert.Equal(t, before, runtime.NumGoroutine())
+	assert.Equal(t, Sum(in), sumArray(h))
+	assert.NoError(t, h.(io.Closer).Close())
+}
+
+func TestWriteString(t *testing.T) {
+	in := sequentialInput(3*BlockSize + 17)
+	for name, newHash := range map[string]func() hash.Hash{
+		"Parallel": func() hash.Hash { return NewParallel(3) },
+		"Paged":    func() hash.Hash { return NewPagedHash(sha256.New, 64*1024, 1024, 3) },
+		"Cached":   func() hash.Hash { return NewParallel(3, WithBlockCache(newMapCache())) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			expected := newHash()
+			expected.Write(in)
+			h := newHash()
+			w := h.(io.StringWriter)
+			n, err := w.WriteString(string(in[:PageSize-5]))
+			assert.NoError(t, err)
+			assert.Equal(t, PageSize-5, n)
+			w.WriteString(string(in[PageSize-5 : 2*PageSize]))
+			w.WriteString(string(in[2*PageSize:]))
+			assert.Equal(t, expected.Sum(nil), h.Sum(nil))
+		})
+	}
+}
+
+func TestWriteByte(t *testing.T) {
+	in := sequentialInput(BlockSize + PageSize + 17)
+	for name, newHash := range map[string]func() hash.Hash{
+		"Parallel": func() hash.Hash { return NewParallel(3) },
+		"Paged":    func() hash.Hash { return NewPagedHash(sha256.New, 64*1024, 1024, 3) },
+		"Cached":   func() hash.Hash { return NewParallel(3, WithBlockCache(newMapCache())) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			expected := newHash()
+			expected.Write(in)
+			h := newHash()
+			w := h.(io.ByteWriter)
+			for _, b := range in {
+				require.NoError(t, w.WriteByte(b))
+			}
+			assert.Equal(t, expected.Sum(nil), h.Sum(nil))
+		})
+	}
+}
+
+func TestWriteByteDoesNotAllocate(t *testing.T) {
+	h := NewSequential().(Hasher)
+	allocs := testing.AllocsPerRun(100, func() {
+		h.WriteByte('x')
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+// randomChunks splits in into pieces of random sizes, biased towards ones that straddle page and block boundaries.
+func randomChunks(r *rand.Rand, in []byte) [][]byte {
+	var chunks [][]byte
+	for len(in) > 0 {
+		var n int
+		switch r.Intn(5) {
+		case 0:
+			n = 1
+		case 1:
+			n = r.Intn(16)
+		case 2:
+			n = PageSize - 1 + r.Intn(3)
+		case 3:
+			n = r.Intn(3 * PageSize)
+		default:
+			n = r.Intn(BlockSize + PageSize)
+		}
+		if n > len(in) {
+			n = len(in)
+		}
+		chunks = append(chunks, in[:n])
+		in = in[n:]
+	}
+	return chunks
+}
+
+func TestWriteChunkingInvariance(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	in := make([]byte, 3*BlockSize+2*PageSize+3)
+	r.Read(in)
+	for name, newHash := range map[string]func() hash.Hash{
+		"Sequential": func() hash.Hash { return NewSequential() },
+		"Parallel":   func() hash.Hash { return NewParallel(4) },
+		"InFlight":   func() hash.Hash { return NewParallel(4, WithMaxInFlightPages(3)) },
+		"Affinity":   func() hash.Hash { return NewParallel(3, WithAffinity(true)) },
+		"Cached":     func() hash.Hash { return NewParallel(4, WithBlockCache(newMapCache())) },
+		"Paged":      func() hash.Hash { return NewPagedHash(sha256.New, 64*1024, 1024, 3) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			expected := newHash()
+			expected.Write(in)
+			sum := expected.Sum(nil)
+			for i := 0; i < 10; i++ {
+				h := newHash().(Hasher)
+				// Randomly mix the different ways of writing, and the caller reusing its buffer afterwards.
+				for _, chunk := range randomChunks(r, in) {
+					switch r.Intn(4) {
+					case 0:
+						h.WriteString(string(chunk))
+					case 1:
+						if len(chunk) < 16 {
+							for _, b := range chunk {
+								h.WriteByte(b)
+							}
+							continue
+						}
+						fallthrough
+					default:
+						buf := append([]byte{}, chunk...)
+						n, err := h.Write(buf)
+						require.NoError(t, err)
+						require.Equal(t, len(chunk), n)
+						r.Read(buf)
+					}
+				}
+				assert.Equal(t, sum, h.Sum(nil))
+				h.Close()
+			}
+		})
+	}
+}
+
+func TestLargeWriteMemoryBounded(t *testing.T) {
+	in := make([]byte, 64*BlockSize+PageSize/2)
+	rand.New(rand.NewSource(3)).Read(in)
+	for _, parallelism := range []int{1, 4} {
+		h := NewParallel(parallelism)
+		// Warm up so the pools have something in them.
+		h.Write(in[:2*BlockSize])
+		h.Reset()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		h.Write(in)
+		runtime.ReadMemStats(&after)
+		// Nothing about in should be copied, so this is much less than even a single block.
+		assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(BlockSize/4), "parallelism %d", parallelism)
+		assert.Equal(t, Sum(in), sumArray(h))
+		h.(io.Closer).Close()
+	}
+}
+
+func TestWriteChunkingEdgeCases(t *testing.T) {
+	in := make([]byte, 2*BlockSize)
+	rand.New(rand.NewSource(7)).Read(in)
+	for name, splits := range map[string][]int{
+		// Single bytes either side of each page and block boundary
+		"StraddlePage":  {PageSize - 1, PageSize, PageSize + 1, PageSize + 2},
+		"StraddleBlock": {BlockSize - 1, BlockSize, BlockSize + 1},
+		// A write that exactly completes the final page, after a partial one
+		"FinishLastPage": {2*BlockSize - PageSize + 5},
+		"EmptyWrites":    {0, 0, 5, 5, BlockSize, BlockSize},
+		"ExactPages":     {PageSize, 2 * PageSize, BlockSize, BlockSize + PageSize},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := NewParallel(4)
+			defer h.(io.Closer).Close()
+			last := 0
+			for _, split := range append(splits, len(in)) {
+				h.Write(in[last:split])
+				last = split
+			}
+			assert.Equal(t, Sum(in), sumArray(h))
+		})
+	}
+}
+
+func TestWriteStringAfterClose(t *testing.T) {
+	h := New().(*vsoHash)
+	h.Close()
+	_, err := h.WriteString("hello")
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestWriteDoesNotRetainInput(t *testing.T) {
+	in := sequentialInput(3*PageSize + 17)
+	buf := append([]byte{}, in...)
+	h := NewParallel(4)
+	defer h.(io.Closer).Close()
+	h.Write(buf)
+	// The caller is free to reuse the slice as soon as Write returns.
+	for i := range buf {
+		buf[i] = 0
+	}
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestWithParallelism(t *testing.T) {
+	in := sequentialInput(BlockSize + 1)
+	h := New(WithParallelism(3))
+	defer h.(io.Closer).Close()
+	assert.Equal(t, 3, cap(h.(*vsoHash).tasks))
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+	// It takes precedence over the constructor's argument.
+	h2 := NewParallel(8, WithParallelism(2))
+	defer h2.(io.Closer).Close()
+	assert.Equal(t, 2, cap(h2.(*vsoHash).tasks))
+	assert.Panics(t, func() { WithParallelism(0) })
+}
+
+func TestWithBufferPool(t *testing.T) {
+	in := sequentialInput(BlockSize + 1)
+	pool := &countingBufferPool{}
+	h := NewParallel(3, WithBufferPool(pool))
+	defer h.(io.Closer).Close()
+	// Writes that don't line up with pages have to be copied into buffers.
+	for i := 0; i < len(in); i += 1000 {
+		end := i + 1000
+		if end > len(in) {
+			end = len(in)
+		}
+		h.Write(in[i:end])
+	}
+	assert.Equal(t, Sum(in), sumArray(h))
+	assert.Equal(t, int32(PagesPerBlock), atomic.LoadInt32(&pool.gets))
+	assert.Equal(t, int32(PagesPerBlock), atomic.LoadInt32(&pool.puts))
+}
+
+// A countingBufferPool is a BufferPool that counts how often it's used.
+type countingBufferPool struct {
+	gets, puts int32
+}
+
+func (p *countingBufferPool) Get() *[PageSize]byte {
+	atomic.AddInt32(&p.gets, 1)
+	return new([PageSize]byte)
+}
+
+func (p *countingBufferPool) Put(*[PageSize]byte) {
+	atomic.AddInt32(&p.puts, 1)
+}
+
+func TestProgress(t *testing.T) {
+	in := sequentialInput(3*BlockSize + 17)
+	var reported []int64
+	h := NewParallel(2, WithProgress(func(n int64) {
+		reported = append(reported, n)
+	}))
+	defer h.(io.Closer).Close()
+	h.Write(in[:BlockSize+PageSize])
+	assert.Equal(t, []int64{BlockSize}, reported)
+	h.Write(in[BlockSize+PageSize:])
+	h.Sum(nil)
+	h.Sum(nil)
+	assert.Equal(t, []int64{BlockSize, 2 * BlockSize, 3 * BlockSize, int64(len(in))}, reported)
+}
+
+func TestLogger(t *testing.T) {
+	in := sequentialInput(2*BlockSize + PageSize + 5)
+	counts := map[string]int{}
+	h := NewParallel(2, WithLogger(func(msg string, args ...any) {
+		assert.Equal(t, 0, len(args)%2, "args should be key/value pairs")
+		counts[msg]++
+	}))
+	defer h.(io.Closer).Close()
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+	assert.Equal(t, map[string]int{
+		"vsohash: dispatched page": 2*PagesPerBlock + 1,
+		"vsohash: finished block":  2,
+		"vsohash: updated blob id": 2,
+		"vsohash: finalising":      1,
+	}, counts)
+}
+
+// A panickyHash is a SHA256 that panics when given a page starting with 0xff.
+type panickyHash struct {
+	hash.Hash
+}
+
+func (h panickyHash) Write(b []byte) (int, error) {
+	if len(b) == PageSize && b[0] == 0xff {
+		panic("kaboom")
+	}
+	return h.Hash.Write(b)
+}
+
+func newPanickyHash(parallelism int) *vsoHash {
+	return newHash(func() hash.Hash { return panickyHash{Hash: newSHA256()} }, BlockSize, PageSize, parallelism, []byte{0}, nil)
+}
+
+// newFailedHash returns a hash that's been given three blocks, where hashing a page of the second one panicked.
+func newFailedHash(t *testing.T) *vsoHash {
+	in := sequentialInput(3 * BlockSize)
+	in[BlockSize+PageSize] = 0xff
+	h := newPanickyHash(4)
+	t.Cleanup(func() { h.Close() })
+	h.Write(in)
+	return h
+}
+
+func TestWorkerPanic(t *testing.T) {
+	for _, parallelism := range []int{1, 4} {
+		t.Run(fmt.Sprintf("Parallelism%d", parallelism), func(t *testing.T) {
+			in := sequentialInput(2 * BlockSize)
+			in[BlockSize+3*PageSize] = 0xff
+			h := newPanickyHash(parallelism)
+			defer h.Close()
+			h.Write(in[:BlockSize+4*PageSize])
+			_, err := h.Write(in[BlockSize+4*PageSize:])
+			var perr *PanicError
+			require.True(t, errors.As(err, &perr))
+			assert.Equal(t, "kaboom", perr.Value)
+			_, err = h.SumErr()
+			assert.Equal(t, perr, err)
+			assert.Panics(t, func() { h.Sum(nil) })
+			_, err = h.MarshalBinary()
+			assert.Equal(t, perr, err)
+			// Reset clears it.
+			h.Reset()
+			h.Write(in[:PageSize])
+			sum, err := h.SumErr()
+			assert.NoError(t, err)
+			assert.Equal(t, Sum(in[:PageSize]), sum)
+		})
+	}
+}
+
+func TestWorkerPanicInLastBlock(t *testing.T) {
+	in := sequentialInput(BlockSize)
+	in[2*PageSize] = 0xff
+	h := newPanickyHash(4)
+	defer h.Close()
+	_, err := h.Write(in[:3*PageSize])
+	assert.NoError(t, err)
+	_, err = h.SumErr()
+	var perr *PanicError
+	assert.True(t, errors.As(err, &perr))
+}
+
+func TestSelfCheck(t *testing.T) {
+	in := sequentialInput(3*BlockSize + PageSize + 5)
+	for name, opts := range map[string][]Option{
+		"Plain":  nil,
+		"Cached": {WithBlockCache(newMapCache())},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := NewParallel(4, append(opts, WithSelfCheck())...).(Hasher)
+			defer h.Close()
+			h.Write(in[:7])
+			h.WriteString(string(in[7 : PageSize+3]))
+			for _, b := range in[PageSize+3 : 2*PageSize] {
+				h.WriteByte(b)
+			}
+			h.ReadFrom(bytes.NewReader(in[2*PageSize : BlockSize+1]))
+			state, err := h.MarshalBinary()
+			require.NoError(t, err)
+			c := h.Clone().(Hasher)
+			defer c.Close()
+			h.Write(in[BlockSize+1:])
+			assert.Equal(t, Sum(in), sumArray(h))
+
+			c.WriteZeros(BlockSize + 12)
+			zeros := append(append([]byte{}, in[:BlockSize+1]...), make([]byte, BlockSize+12)...)
+			assert.Equal(t, Sum(zeros), sumArray(c))
+
+			require.NoError(t, c.UnmarshalBinary(state))
+			c.Write(in[BlockSize+1:])
+			assert.Equal(t, Sum(in), sumArray(c))
+			c.Reset()
+			c.Write(in[:5])
+			assert.Equal(t, Sum(in[:5]), sumArray(c))
+		})
+	}
+}
+
+func TestSelfCheckDetectsMismatch(t *testing.T) {
+	h := NewParallel(4, WithSelfCheck()).(*vsoHash)
+	defer h.Close()
+	h.Write(sequentialInput(BlockSize + 3))
+	h.shadow.Write([]byte("oops"))
+	assert.Panics(t, func() { h.Sum(nil) })
+}
+
+func TestBytesWritten(t *testing.T) {
+	h := New().(Hasher)
+	defer h.Close()
+	assert.Equal(t, int64(0), h.BytesWritten())
+	h.Write(sequentialInput(BlockSize + 1))
+	assert.Equal(t, int64(BlockSize+1), h.BytesWritten())
+	h.Reset()
+	assert.Equal(t, int64(0), h.BytesWritten())
+}
+
+func TestStats(t *testing.T) {
+	h := New().(Hasher)
+	defer h.Close()
+	assert.Equal(t, Stats{}, h.Stats())
+	h.Write(sequentialInput(2*BlockSize + 3*PageSize + 1))
+	assert.Equal(t, Stats{
+		BytesWritten:   2*BlockSize + 3*PageSize + 1,
+		PagesHashed:    2*PagesPerBlock + 3,
+		BlocksFinished: 2,
+	}, h.Stats())
+	h.Reset()
+	assert.Equal(t, Stats{}, h.Stats())
+}
+
+func TestStatsCached(t *testing.T) {
+	in := bytes.Repeat([]byte{0xab}, 2*BlockSize)
+	h := New(WithBlockCache(newMapCache())).(Hasher)
+	defer h.Close()
+	h.Write(in)
+	// The second block is the same as the first, so it comes from the cache.
+	assert.Equal(t, Stats{BytesWritten: 2 * BlockSize, PagesHashed: PagesPerBlock, BlocksFinished: 2}, h.Stats())
+}
+
+func TestParallelismCapped(t *testing.T) {
+	h := NewParallel(1000).(*vsoHash)
+	defer h.Close()
+	assert.Equal(t, PagesPerBlock, cap(h.tasks))
+	h2 := NewParallel(1000, WithMaxInFlightPages(5)).(*vsoHash)
+	defer h2.Close()
+	assert.Equal(t, 5, cap(h2.tasks))
+	// Small blocks have fewer pages to go round.
+	h3 := NewPagedHash(sha256.New, 4096, 1024, 100).(*vsoHash)
+	defer h3.Close()
+	assert.Equal(t, 4, cap(h3.tasks))
+	in := sequentialInput(3*BlockSize + 17)
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestSumInto(t *testing.T) {
+	in := sequentialInput(BlockSize + PageSize + 1)
+	h := New().(Hasher)
+	defer h.Close()
+	h.Write(in)
+	var dst [Size]byte
+	h.SumInto(&dst)
+	assert.Equal(t, Sum(in), dst)
+	assert.Equal(t, h.Sum(nil), dst[:])
+	allocs := testing.AllocsPerRun(10, func() {
+		h.SumInto(&dst)
+	})
+	assert.Equal(t, 0.0, allocs)
+	assert.Panics(t, func() {
+		NewPagedHash(sha256.New, 4096, 1024, 1).(Hasher).SumInto(&dst)
+	})
+}
+
+func TestWithExpectedSize(t *testing.T) {
+	for _, expected := range []int64{0, 2*BlockSize + 1, 100 * BlockSize} {
+		t.Run(fmt.Sprint(expected), func(t *testing.T) {
+			in := sequentialInput(5*BlockSize + 3)
+			h := NewParallel(4, WithExpectedSize(expected))
+			defer h.(io.Closer).Close()
+			h.Write(in)
+			assert.Equal(t, Sum(in), sumArray(h))
+			assert.Equal(t, blockHashesOf(in), h.(Hasher).BlockHashes())
+		})
+	}
+}
+
+func TestWithExpectedSizeLimitsParallelism(t *testing.T) {
+	h := NewParallel(8, WithExpectedSize(3*PageSize)).(*vsoHash)
+	defer h.Close()
+	assert.Equal(t, 3, cap(h.tasks))
+	assert.Equal(t, 1, cap(h.blockHashes))
+	// Small enough inputs are hashed inline.
+	h2 := NewParallel(8, WithExpectedSize(100)).(*vsoHash)
+	assert.Nil(t, h2.tasks)
+	assert.Panics(t, func() { WithExpectedSize(-1) })
+}
+
+func TestWithExpectedSizeCapsPreallocation(t *testing.T) {
+	h := NewParallel(4, WithExpectedSize(math.MaxInt64)).(*vsoHash)
+	defer h.Close()
+	assert.Equal(t, maxPreallocatedBlocks, cap(h.blockHashes))
+	in := sequentialInput(2*BlockSize + 1)
+	h.Write(in)
+	assert.Equal(t, Sum(in), sumArray(h))
+}
+
+func TestBlobIDPreallocated(t *testing.T) {
+	seed := strings.Repeat("s", 100)
+	h := NewPaged(PageSize, BlockSize, 1, WithSeed(seed)).(*vsoHash)
+	assert.GreaterOrEqual(t, h.blobID.Cap(), len(seed)+sha256.Size)
+	h.Write(sequentialInput(BlockSize))
+	h.resolveBlocks()
+	assert.Equal(t, len(seed)+sha256.Size, h.blobID.Len())
+}
@@ -0,0 +1,100 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+)
+
+// zeroPage is a page of zeroes, used as input when they can't be skipped.
+var zeroPage [PageSize]byte
+
+// The hashes of a page and of a whole block of zeroes (for the standard VSO-Hash structure).
+var (
+	zeroPageHash  = sum256(zeroPage[:])
+	zeroBlockHash = hashZeroBlock()
+)
+
+func hashZeroBlock() [sha256.Size]byte {
+	h := newSHA256()
+	for i := 0; i < PagesPerBlock; i++ {
+		h.Write(zeroPageHash[:])
+	}
+	var ret [sha256.Size]byte
+	h.Sum(ret[:0])
+	return ret
+}
+
+// WriteZeros writes n zero bytes to the hash, and returns how many it wrote (which is only less than n if it
+// returns an error, as for Write). The result is the same as writing them with Write, but whole pages and blocks
+// of zeroes use precomputed hashes rather than hashing them again, so this is far quicker for e.g. the holes
+// in a sparse file; only a partial page at either end needs hashing. Pages written this way aren't counted in
+// Stats' PagesHashed, since they never are.
+// Hashes with a block cache or a structure other than the standard VSO-Hash one don't get any faster.
+func (v *vsoHash) WriteZeros(n int64) (int64, error) {
+	start := v.written
+	err := v.writeZerosFast(n)
+	if v.shadow != nil {
+		// This doesn't use the fast path, so the self-check checks that too.
+		v.shadow.writeZeros(v.written - start)
+	}
+	return v.written - start, err
+}
+
+// writeZerosFast does the work of WriteZeros, for which it keeps track of how much was written.
+func (v *vsoHash) writeZerosFast(n int64) error {
+	if n < 0 {
+		panic("Number of zeroes must not be negative")
+	} else if v.opts.cache != nil || v.pageSize != PageSize || v.pagesPerBlock != PagesPerBlock || v.inner.Size() != sha256.Size {
+		return v.writeZeros(n)
+	} else if err := v.writable(); err != nil {
+		return err
+	}
+	// Finish off any partial page first.
+	if v.buffer.Len() > 0 {
+		m := int64(PageSize - v.buffer.Len())
+		if m > n {
+			m = n
+		}
+		if err := v.writeZeros(m); err != nil {
+			return err
+		}
+		n -= m
+	}
+	for n >= PageSize {
+		if err := v.opts.ctxErr(); err != nil {
+			return err
+		}
+		if v.current.n == 0 && n >= BlockSize {
+			// A whole block; the pending ones have to go into the blob id first so it's in order.
+			v.resolveBlocks()
+			v.written += BlockSize
+			v.updateBlobID(zeroBlockHash[:])
+			n -= BlockSize
+			continue
+		}
+		// Nothing else touches this page of the block (the workers only write to the ones they've been given).
+		copy(v.current.pages[v.current.n][:], zeroPageHash[:])
+		v.current.n++
+		v.written += PageSize
+		n -= PageSize
+		if v.current.n == v.pagesPerBlock {
+			v.finishBlock()
+		}
+	}
+	v.resolveBlocks()
+	return v.writeZeros(n)
+}
+
+// writeZeros writes n zero bytes to the hash via Write.
+func (v *vsoHash) writeZeros(n int64) error {
+	for n > 0 {
+		m := int64(len(zeroPage))
+		if m > n {
+			m = n
+		}
+		if _, err := v.write(zeroPage[:m]); err != nil {
+			return err
+		}
+		n -= m
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package vsohash
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZeroHashes(t *testing.T) {
+	assert.Equal(t, sha256.Sum256(make([]byte, PageSize)), zeroPageHash)
+	assert.Equal(t, blockHashesOf(make([]byte, BlockSize))[0], zeroBlockHash)
+}
+
+func TestWriteZeros(t *testing.T) {
+	for _, tc := range []struct {
+		Prefix, Zeros, Suffix int
+	}{
+		{0, 0, 0},
+		{0, 5 * BlockSize, 0}, // As for TestHashAlgorithmIsStable
+		{0, 17, 0},
+		{3, PageSize, 0},
+		{PageSize - 3, 2*BlockSize + 12, 7},
+		{BlockSize + PageSize, 3*BlockSize + PageSize + 1, PageSize + 2},
+		{5, 31 * PageSize, BlockSize},
+	} {
+		t.Run(fmt.Sprintf("%d_%d_%d", tc.Prefix, tc.Zeros, tc.Suffix), func(t *testing.T) {
+			in := sequentialInput(tc.Prefix + tc.Zeros + tc.Suffix)
+			for i := tc.Prefix; i < tc.Prefix+tc.Zeros; i++ {
+				in[i] = 0
+			}
+			for name, newHash := range map[string]func() hash.Hash{
+				"Parallel":   func() hash.Hash { return NewParallel(4) },
+				"Sequential": func() hash.Hash { return NewSequential() },
+				"Cached":     func() hash.Hash { return NewParallel(4, WithBlockCache(newMapCache())) },
+				"Paged":      func() hash.Hash { return NewPagedHash(sha256.New, 64*1024, 1024, 3) },
+			} {
+				t.Run(name, func(t *testing.T) {
+					expected := newHash()
+					expected.Write(in)
+					h := newHash().(Hasher)
+					defer h.Close()
+					h.Write(in[:tc.Prefix])
+					n, err := h.WriteZeros(int64(tc.Zeros))
+					require.NoError(t, err)
+					assert.EqualValues(t, tc.Zeros, n)
+					h.Write(in[tc.Prefix+tc.Zeros:])
+					assert.Equal(t, expected.Sum(nil), h.Sum(nil))
+					assert.EqualValues(t, len(in), h.BytesWritten())
+					assert.Equal(t, expected.(Hasher).BlockHashes(), h.BlockHashes())
+				})
+			}
+		})
+	}
+}
+
+func TestWriteZerosAfterClose(t *testing.T) {
+	h := New().(Hasher)
+	h.Close()
+	n, err := h.WriteZeros(BlockSize)
+	assert.Equal(t, ErrClosed, err)
+	assert.EqualValues(t, 0, n)
+
+	// The self-check hash shouldn't see any of it either.
+	h = New(WithSelfCheck()).(Hasher)
+	h.Write([]byte("hello"))
+	h.Close()
+	n, err = h.WriteZeros(10)
+	assert.Equal(t, ErrClosed, err)
+	assert.EqualValues(t, 0, n)
+	assert.NotPanics(t, func() { h.Sum(nil) })
+}
+
+func BenchmarkWriteZeros(b *testing.B) {
+	h := NewSequential().(Hasher)
+	b.SetBytes(64 * BlockSize)
+	for i := 0; i < b.N; i++ {
+		h.Reset()
+		h.WriteZeros(64 * BlockSize)
+		h.Sum(nil)
+	}
+}